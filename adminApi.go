@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/fileStorage"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var AdminBadRequestError = errors.New("bad request")
+var AdminIterationWaitError = errors.New("cancelled while waiting for iteration")
+
+// iterationLock serializes scheduled iterations with admin actions, waiting is cancelled with request context
+type iterationLock chan struct{}
+
+func newIterationLock() iterationLock {
+	return make(iterationLock, 1)
+}
+
+func (lock iterationLock) lock(ctx context.Context) error {
+	select {
+	case lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lockTimeout returns IterationHungError when iteration (e.g. abandoned by watchdog) holds the lock longer than timeout,
+// timeout 0 waits without limit
+func (lock iterationLock) lockTimeout(timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if lock.lock(ctx) != nil {
+		return fmt.Errorf("%w: iteration lock is held longer than %s", IterationHungError, timeout)
+	}
+
+	return nil
+}
+
+func (lock iterationLock) unlock() {
+	<-lock
+}
+
+// adminAction returns response and summary for the action log
+type adminAction func(request *http.Request) (response interface{}, summary string, err error)
+
+type setStateRequest struct {
+	State  dbState
+	Reason string
+}
+
+// AdminApi - endpoints on the status server authenticated with bearer ADMIN_TOKEN:
+// `POST /check`, `PUT /state` and `POST /events/year`. Check is guarded by watchdog like scheduled iteration.
+type AdminApi struct {
+	out      io.Writer
+	config   Config
+	lock     iterationLock
+	guard    *iterationGuard
+	storage  fileStorage.Interface
+	eventbus MetaEventbusInterface
+	check    func() (checkResult, error)
+}
+
+// NewAdminApi returns nil when ADMIN_TOKEN is not configured
+func NewAdminApi(
+	out io.Writer, config Config, lock iterationLock,
+	storage fileStorage.Interface, eventbus MetaEventbusInterface, check func() (checkResult, error),
+) *AdminApi {
+	if config.adminToken == "" {
+		return nil
+	}
+
+	return &AdminApi{
+		out:      out,
+		config:   config,
+		lock:     lock,
+		guard:    newIterationGuard(out, config.iterationTimeout),
+		storage:  storage,
+		eventbus: eventbus,
+		check:    check,
+	}
+}
+
+func (api *AdminApi) register(statusServer *StatusServer) {
+	statusServer.handle("/check", api.handler(http.MethodPost, api.runCheck))
+	statusServer.handle("/state", api.handler(http.MethodPut, api.locked(api.setState)))
+	statusServer.handle("/events/year", api.handler(http.MethodPost, api.locked(api.sendCurrentYear)))
+}
+
+// handler authenticates request and logs every action
+func (api *AdminApi) handler(method string, action adminAction) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logPrefix := getCurrentDatetime() + " Admin API " + request.Method + " " + request.URL.Path + " from " + request.RemoteAddr
+
+		if request.Method != method {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !api.authorized(request) {
+			fmt.Fprintln(api.out, logPrefix+": unauthorized")
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminResponse(writer, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		response, summary, err := action(request)
+
+		err = hideSecrets(err, api.config)
+		if err != nil {
+			fmt.Fprintln(api.out, logPrefix+": "+summary+" failed: "+err.Error())
+			status := http.StatusInternalServerError
+			if errors.Is(err, AdminBadRequestError) {
+				status = http.StatusBadRequest
+			} else if errors.Is(err, AdminIterationWaitError) || errors.Is(err, IterationHungError) || errors.Is(err, NotLeaderError) {
+				status = http.StatusServiceUnavailable
+			}
+			writeAdminResponse(writer, status, map[string]string{"error": err.Error()})
+			return
+		}
+
+		fmt.Fprintln(api.out, logPrefix+": "+summary+" done")
+		writeAdminResponse(writer, http.StatusOK, response)
+	}
+}
+
+func (api *AdminApi) authorized(request *http.Request) bool {
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(api.config.adminToken)) == 1
+}
+
+// locked - action waits for the running iteration, lock is released even on panic
+func (api *AdminApi) locked(action adminAction) adminAction {
+	return func(request *http.Request) (response interface{}, summary string, err error) {
+		err = api.withLock(request, func() error {
+			response, summary, err = action(request)
+			return err
+		})
+		if summary == "" {
+			summary = "wait for iteration"
+		}
+
+		return response, summary, err
+	}
+}
+
+func (api *AdminApi) withLock(request *http.Request, action func() error) error {
+	err := api.lock.lock(request.Context())
+	if err != nil {
+		return fmt.Errorf("%w: %w", AdminIterationWaitError, err)
+	}
+	defer api.lock.unlock()
+
+	return action()
+}
+
+// runCheck - hung check is abandoned after ITERATION_TIMEOUT, next check is refused until it finishes
+func (api *AdminApi) runCheck(request *http.Request) (interface{}, string, error) {
+	var guardedResult checkResult
+	err := api.guard.run(func() error {
+		return api.withLock(request, func() error {
+			var err error
+			guardedResult, err = api.check()
+			return err
+		})
+	})
+
+	// abandoned check could still write its result
+	if errors.Is(err, IterationHungError) {
+		return nil, "check", err
+	}
+
+	summary := "check"
+	if guardedResult.Status != "" {
+		summary += " with result " + guardedResult.Status
+	}
+
+	return guardedResult, summary, err
+}
+
+// setState replaces stored state, previous state goes to history like after announcement
+func (api *AdminApi) setState(request *http.Request) (interface{}, string, error) {
+	var stateRequest setStateRequest
+	err := json.NewDecoder(request.Body).Decode(&stateRequest)
+	if err != nil {
+		return nil, "set state", classifyError(AdminBadRequestError, errors.New("invalid request body: "+err.Error()))
+	}
+
+	summary := fmt.Sprintf("set state %s (year %d), reason %q", stateRequest.State.ActualDatetime.Format(StorageTimeFormat),
+		stateRequest.State.EducationYear, stateRequest.Reason)
+	if strings.TrimSpace(stateRequest.Reason) == "" {
+		return nil, summary, classifyError(AdminBadRequestError, errors.New("reason is required"))
+	}
+	if stateRequest.State.ActualDatetime.IsZero() || stateRequest.State.EducationYear == 0 {
+		return nil, summary, classifyError(AdminBadRequestError, errors.New("state ActualDatetime and EducationYear are required"))
+	}
+
+	document, err := readStateDocument(api.storage)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	document = document.next(stateRequest.State)
+	err = api.storage.Set(document.marshal())
+	if err != nil {
+		return nil, summary, fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return document, summary, nil
+}
+
+// sendCurrentYear republishes CurrentYearEvent with education year of stored state
+func (api *AdminApi) sendCurrentYear(request *http.Request) (interface{}, string, error) {
+	document, err := readStateDocument(api.storage)
+	if err != nil {
+		return nil, "send current year event", err
+	}
+
+	year := document.State.EducationYear
+	summary := fmt.Sprintf("send current year event %d", year)
+	if year == 0 {
+		return nil, summary, classifyError(AdminBadRequestError, errors.New("current year is unknown, stored state is empty"))
+	}
+
+	err = api.eventbus.sendCurrentYearEvent(year, stateTransition{Before: document.State, After: document.State})
+	if err != nil {
+		return nil, summary, classifyError(KafkaUnreachableError, fmt.Errorf("Failed to send Current year event to Kafka: %w", err))
+	}
+
+	return map[string]int{"year": year}, summary, nil
+}
+
+func writeAdminResponse(writer http.ResponseWriter, status int, response interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(response)
+}
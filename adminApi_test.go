@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	fileStorageMocks "github.com/kneu-messenger-pigeon/fileStorage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminApi(t *testing.T) {
+	config := Config{adminToken: "admin-secret"}
+	state := dbState{ActualDatetime: time.Date(2023, 9, 1, 4, 0, 0, 0, time.UTC), EducationYear: 2023}
+	storedDocument := stateDocument{}.next(state).marshal()
+
+	newServer := func(api *AdminApi) *StatusServer {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+		api.register(statusServer)
+		return statusServer
+	}
+
+	request := func(statusServer *StatusServer, method string, path string, body string, token string) *httptest.ResponseRecorder {
+		httpRequest := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			httpRequest.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		statusServer.server.Handler.ServeHTTP(recorder, httpRequest)
+		return recorder
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewAdminApi(&bytes.Buffer{}, Config{}, newIterationLock(), nil, nil, nil))
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), nil, nil, nil)
+		statusServer := newServer(api)
+
+		assert.Equal(t, http.StatusUnauthorized, request(statusServer, http.MethodPost, "/check", "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, request(statusServer, http.MethodPost, "/check", "", "wrong").Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, request(statusServer, http.MethodGet, "/check", "", "admin-secret").Code)
+		assert.Contains(t, out.String(), "Admin API POST /check from 192.0.2.1:1234: unauthorized")
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), nil, nil, func() (checkResult, error) {
+			return checkResult{Status: CheckResultAnnounced, CurrentState: state}, nil
+		})
+
+		recorder := request(newServer(api), http.MethodPost, "/check", "", "admin-secret")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"Status":"announced"`)
+		assert.Contains(t, out.String(), "Admin API POST /check from 192.0.2.1:1234: check with result announced done")
+	})
+
+	t.Run("Failed check hides secrets", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), nil, nil, func() (checkResult, error) {
+			return checkResult{}, errors.New("token admin-secret is leaked")
+		})
+
+		recorder := request(newServer(api), http.MethodPost, "/check", "", "admin-secret")
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "admin-secret")
+		assert.NotContains(t, out.String(), "admin-secret")
+	})
+
+	t.Run("Check waits for running iteration", func(t *testing.T) {
+		lock := newIterationLock()
+		_ = lock.lock(context.Background())
+
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, lock, nil, nil, nil)
+		httpRequest := httptest.NewRequest(http.MethodPost, "/check", nil)
+		httpRequest.Header.Set("Authorization", "Bearer admin-secret")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		recorder := httptest.NewRecorder()
+		newServer(api).server.Handler.ServeHTTP(recorder, httpRequest.WithContext(ctx))
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, out.String(), "cancelled while waiting for iteration")
+	})
+
+	t.Run("Hung check is abandoned", func(t *testing.T) {
+		lock := newIterationLock()
+		release := make(chan struct{})
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, Config{adminToken: "admin-secret", iterationTimeout: time.Millisecond * 10}, lock, nil, nil, func() (checkResult, error) {
+			<-release
+			return checkResult{Status: CheckResultUnchanged}, nil
+		})
+		statusServer := newServer(api)
+
+		recorder := request(statusServer, http.MethodPost, "/check", "", "admin-secret")
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "iteration abandoned")
+
+		recorder = request(statusServer, http.MethodPost, "/check", "", "admin-secret")
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "previous abandoned iteration is still running")
+
+		close(release)
+		assert.NoError(t, lock.lockTimeout(time.Second), "abandoned check releases lock when finished")
+		lock.unlock()
+
+		recorder = request(statusServer, http.MethodPost, "/check", "", "admin-secret")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, out.String(), "check with result unchanged done")
+	})
+
+	t.Run("Check panic is recovered", func(t *testing.T) {
+		lock := newIterationLock()
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, lock, nil, nil, func() (checkResult, error) {
+			panic("nil map")
+		})
+
+		recorder := request(newServer(api), http.MethodPost, "/check", "", "admin-secret")
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "iteration panic: nil map")
+		assert.NoError(t, lock.lockTimeout(time.Millisecond))
+	})
+
+	t.Run("Lock is released after action panic", func(t *testing.T) {
+		lock := newIterationLock()
+		storage := fileStorageMocks.NewInterface(t)
+		storage.On("Get").Run(func(args mock.Arguments) {
+			panic("storage panic")
+		}).Return(nil, nil)
+
+		api := NewAdminApi(&bytes.Buffer{}, config, lock, storage, nil, nil)
+		statusServer := newServer(api)
+
+		assert.PanicsWithValue(t, "storage panic", func() {
+			request(statusServer, http.MethodPost, "/events/year", "", "admin-secret")
+		})
+		assert.NoError(t, lock.lockTimeout(time.Millisecond))
+	})
+
+	t.Run("Set state waits for running iteration", func(t *testing.T) {
+		lock := newIterationLock()
+		_ = lock.lock(context.Background())
+
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, lock, fileStorageMocks.NewInterface(t), nil, nil)
+		httpRequest := httptest.NewRequest(http.MethodPut, "/state", strings.NewReader(`{}`))
+		httpRequest.Header.Set("Authorization", "Bearer admin-secret")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		recorder := httptest.NewRecorder()
+		newServer(api).server.Handler.ServeHTTP(recorder, httpRequest.WithContext(ctx))
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, out.String(), "wait for iteration failed: cancelled while waiting for iteration: context deadline exceeded")
+	})
+
+	t.Run("Set state", func(t *testing.T) {
+		newState := dbState{ActualDatetime: time.Date(2023, 9, 5, 4, 0, 0, 0, time.UTC), EducationYear: 2023}
+
+		storage := fileStorageMocks.NewInterface(t)
+		storage.On("Get").Return(storedDocument, nil)
+		storage.On("Set", stateDocument{History: []dbState{}}.next(state).next(newState).marshal()).Return(nil)
+
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), storage, nil, nil)
+		body := `{"State": {"ActualDatetime": "2023-09-05T04:00:00Z", "EducationYear": 2023}, "Reason": "skip broken load"}`
+
+		recorder := request(newServer(api), http.MethodPut, "/state", body, "admin-secret")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, out.String(), `set state 2023-09-05T04:00:00Z (year 2023), reason "skip broken load" done`)
+	})
+
+	t.Run("Set state without reason", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), fileStorageMocks.NewInterface(t), nil, nil)
+		body := `{"State": {"ActualDatetime": "2023-09-05T04:00:00Z", "EducationYear": 2023}}`
+
+		recorder := request(newServer(api), http.MethodPut, "/state", body, "admin-secret")
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "reason is required")
+	})
+
+	t.Run("Set invalid state", func(t *testing.T) {
+		api := NewAdminApi(&bytes.Buffer{}, config, newIterationLock(), fileStorageMocks.NewInterface(t), nil, nil)
+		statusServer := newServer(api)
+
+		recorder := request(statusServer, http.MethodPut, "/state", `{"Reason": "empty state"}`, "admin-secret")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		recorder = request(statusServer, http.MethodPut, "/state", `not json`, "admin-secret")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "invalid request body")
+	})
+
+	t.Run("Send current year", func(t *testing.T) {
+		storage := fileStorageMocks.NewInterface(t)
+		storage.On("Get").Return(storedDocument, nil)
+		eventbus := NewMockMetaEventbusInterface(t)
+		eventbus.On("sendCurrentYearEvent", 2023, stateTransition{Before: state, After: state}).Return(nil)
+
+		out := &bytes.Buffer{}
+		api := NewAdminApi(out, config, newIterationLock(), storage, eventbus, nil)
+
+		recorder := request(newServer(api), http.MethodPost, "/events/year", "", "admin-secret")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"year": 2023}`, recorder.Body.String())
+		assert.Contains(t, out.String(), "send current year event 2023 done")
+	})
+
+	t.Run("Send current year without state", func(t *testing.T) {
+		storage := fileStorageMocks.NewInterface(t)
+		storage.On("Get").Return([]byte{}, nil)
+
+		api := NewAdminApi(&bytes.Buffer{}, config, newIterationLock(), storage, NewMockMetaEventbusInterface(t), nil)
+
+		recorder := request(newServer(api), http.MethodPost, "/events/year", "", "admin-secret")
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "current year is unknown")
+	})
+
+	t.Run("Standby replica refuses writes", func(t *testing.T) {
+		election := newTestLeaderElection(&bytes.Buffer{}, t.TempDir()+"/lease.json", "standby")
+		storage := fileStorageMocks.NewInterface(t)
+		storage.On("Get").Return(storedDocument, nil)
+		eventbus := NewMockMetaEventbusInterface(t)
+
+		out := &bytes.Buffer{}
+		api := NewAdminApi(
+			out, config, newIterationLock(),
+			leaderFencedStorage{Interface: storage, election: election},
+			leaderFencedEventbus{MetaEventbusInterface: eventbus, election: election}, nil,
+		)
+		statusServer := newServer(api)
+		body := `{"State": {"ActualDatetime": "2023-09-05T04:00:00Z", "EducationYear": 2023}, "Reason": "skip broken load"}`
+
+		recorder := request(statusServer, http.MethodPut, "/state", body, "admin-secret")
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "leadership is lost: state is not saved")
+
+		recorder = request(statusServer, http.MethodPost, "/events/year", "", "admin-secret")
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "leadership is lost: CurrentYearEvent is not sent")
+
+		storage.AssertNotCalled(t, "Set", mock.Anything)
+		eventbus.AssertNotCalled(t, "sendCurrentYearEvent", mock.Anything, mock.Anything)
+	})
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/kneu-messenger-pigeon/events"
@@ -10,39 +10,73 @@ import (
 	"github.com/segmentio/kafka-go"
 	"io"
 	"os"
+	"os/signal"
+	"time"
 )
 
 const ExitCodeMainError = 1
 const ExitCodeLoopIsBroken = 2
 const ExitCodeTooManyErrorInLoop = 3
+const ExitCodeStorageIsLocked = 4
+const ExitCodeLoadAnnounced = 5
+const ExitCodeConfigInvalid = 6
+const ExitCodeDbUnreachable = 7
+const ExitCodeDbSchemaMismatch = 8
+const ExitCodeKafkaUnreachable = 9
+const ExitCodeStorageUnreadable = 10
+const ExitCodeDbAccessDenied = 11
 
-func runApp(out io.Writer) error {
-	envFilename := ""
-	if _, err := os.Stat(".env"); err == nil {
-		envFilename = ".env"
+// runApp checks DB in loop, or only once (for cron) with JSON summary written to summaryOut when it is not nil
+func runApp(out io.Writer, summaryOut io.Writer) (err error) {
+	once := summaryOut != nil
+
+	// TERMINATION_LOG is read from env before config load, so report is written even for invalid config
+	terminationReport := NewTerminationReport(os.Getenv("TERMINATION_LOG"))
+	defer func() {
+		reportErr := terminationReport.write(err)
+		if reportErr != nil {
+			fmt.Fprintln(out, "Failed to write termination report: "+reportErr.Error())
+		}
+	}()
+
+	// SIGUSR1/SIGUSR2 are handled in main loop pause, they should not terminate process at start or during recovery
+	// signal.Notify without signals relays all of them, so it is skipped on platforms without user signals
+	if len(userSignals) != 0 {
+		ignoredSignals := make(chan os.Signal, 1)
+		signal.Notify(ignoredSignals, userSignals...)
+		defer signal.Stop(ignoredSignals)
 	}
 
-	config, err := loadConfig(envFilename)
+	config, err := loadConfig(getEnvFilename())
 	if err != nil {
-		return errors.New("Failed to load config: " + err.Error())
+		return classifyError(ConfigInvalidError, errors.New("Failed to load config: "+err.Error()))
+	}
+	terminationReport.file = config.terminationLog
+	for _, warning := range config.warnings {
+		fmt.Fprintln(out, getCurrentDatetime()+" WARNING: "+warning)
 	}
 
+	auditLog := NewAuditLog(config)
 	eventbus := MetaEventbus{
-		out: out,
-		writer: &kafka.Writer{
-			Addr:     kafka.TCP(config.kafkaHost),
-			Topic:    events.MetaEventsTopic,
-			Balancer: &kafka.LeastBytes{},
-		},
+		out:    out,
+		writer: newKafkaWriter(config, auditLog),
+		audit:  auditLog,
 	}
 
-	storage := fileStorage.Storage{
-		File: config.storageFile,
+	// with leader election storage is locked only by the leader, so standby replica keeps running
+	if config.leaderElectionLeaseFile == "" {
+		storageLock, err := lockStorage(config.storageFile)
+		if err != nil {
+			return err
+		}
+		defer storageLock.unlock()
 	}
 
-	secondaryDekanatDb, err := sql.Open(config.dekanatDbDriverName, config.secondaryDekanatDbDSN)
+	storage := NewSafeStorage(out, config)
+
+	secondaryDekanatDb, err := openSecondaryDekanatDb(config)
 	if err != nil {
-		return errors.New("Wrong connection configuration for secondary Dekanat DB: " + err.Error())
+		return classifyError(ConfigInvalidError, errors.New("Wrong connection configuration for secondary Dekanat DB: "+hideSecrets(err, config).Error()))
 	}
 	defer func() {
 		eventbus.writer.Close()
@@ -51,32 +85,261 @@ func runApp(out io.Writer) error {
 
 	_, err = storage.Get()
 	if err != nil {
-		return errors.New(fmt.Sprintf(
+		return classifyError(StorageUnreadableError, errors.New(fmt.Sprintf(
 			"Failed to load storage file %s - %s \n", config.storageFile, err,
-		))
+		)))
 	}
 
-	return runMainLoop(config, out, func() error {
-		return checkDekanatDb(secondaryDekanatDb, &storage, &eventbus)
+	statusServer := NewStatusServer(out, config.statusListen)
+	statusServer.start()
+	defer statusServer.close()
+
+	// checks use fenced storage and eventbus, so leader does not write after its lease is lost
+	var checkStorage fileStorage.Interface = storage
+	var checkEventbus MetaEventbusInterface = &eventbus
+	var leaderElection *LeaderElection
+	if config.leaderElectionLeaseFile != "" {
+		leaderElection = NewLeaderElection(out, config)
+		leaderElection.start()
+		defer leaderElection.close()
+		statusServer.register("leaderElection", leaderElection.status)
+
+		checkStorage = leaderFencedStorage{Interface: storage, election: leaderElection}
+		checkEventbus = leaderFencedEventbus{MetaEventbusInterface: &eventbus, election: leaderElection}
+	}
+
+	stability := NewStabilityPolicy(config)
+	if stability != nil {
+		statusServer.register("stability", stability.status)
+	}
+
+	restoreDetector := NewRestoreDetector(out, config)
+
+	trigger := NewIterationTrigger()
+	statusServer.register("detection", trigger.status)
+	statusServer.registerLabeledMetric(
+		"secondary_db_checks_total", "DB checks by trigger source", "counter", "source", trigger.checkCounts,
+	)
+	statusServer.registerLabeledMetric(
+		"secondary_db_loads_total", "Detected DB loads by trigger source", "counter", "source", trigger.loadCounts,
+	)
+	statusServer.registerMetric(
+		"secondary_db_last_load_timestamp_seconds", "Unix time of the last detected DB load", trigger.lastLoadTimestamp,
+	)
+	statusServer.register("state", func() interface{} {
+		document, err := readStateDocument(storage)
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+		return document.State
 	})
+	if config.secondaryDekanatDbEventName != "" && !once {
+		dbEventListener := NewDbEventListener(out, config, trigger)
+		dbEventListener.start()
+		defer dbEventListener.close()
+	}
+
+	fileWatcher := NewFileWatcher(out, config, trigger)
+	if fileWatcher != nil && !once {
+		fileWatcher.start()
+		defer fileWatcher.close()
+		statusServer.register("fileWatch", fileWatcher.status)
+	}
+
+	var replicationLagMonitor *ReplicationLagMonitor
+	if config.primaryDekanatDbDSN != "" {
+		primaryDekanatDb, err := openPrimaryDekanatDb(config)
+		if err != nil {
+			return classifyError(ConfigInvalidError, errors.New("Wrong connection configuration for primary Dekanat DB: "+hideSecrets(err, config).Error()))
+		}
+		defer primaryDekanatDb.Close()
+
+		replicationLagMonitor = NewReplicationLagMonitor(config, primaryDekanatDb)
+		statusServer.register("replicationLag", replicationLagMonitor.status)
+		statusServer.registerMetric(
+			"secondary_db_replication_lag_seconds", "Lag of secondary Dekanat DB behind primary DB",
+			replicationLagMonitor.lagSeconds,
+		)
+	}
+
+	readOnlyGuard := NewReadOnlyGuard(out, config)
+
+	runCheck := func(source string) (checkResult, error) {
+		if readOnlyGuard != nil {
+			err := readOnlyGuard.verify(secondaryDekanatDb)
+			if err != nil {
+				terminationReport.record(checkResult{}, err)
+				return checkResult{}, err
+			}
+		}
+
+		if restoreDetector != nil {
+			restoreDetector.verifyPrivilege(secondaryDekanatDb)
+		}
+
+		if leaderElection != nil && !leaderElection.isLeader(time.Now()) {
+			fmt.Fprintln(out, getCurrentDatetime()+" standby, skip DB check")
+			return checkResult{Status: CheckResultStandby}, nil
+		}
+
+		result, err := checkDekanatDb(secondaryDekanatDb, checkStorage, checkEventbus, stability, restoreDetector)
+		if err != nil && leaderElection != nil && !leaderElection.isLeader(time.Now()) {
+			fmt.Fprintln(out, getCurrentDatetime()+" leadership is lost during DB check, standby: "+hideSecrets(err, config).Error())
+			return checkResult{Status: CheckResultStandby}, nil
+		}
+		err = hideSecrets(err, config)
+		terminationReport.record(result, err)
+		// lag monitoring is informational and does not fail the iteration
+		if replicationLagMonitor != nil && !result.CurrentState.ActualDatetime.IsZero() {
+			_, lagErr := replicationLagMonitor.measure(result.CurrentState, checkEventbus, time.Now())
+			if lagErr != nil {
+				fmt.Fprintln(out, getCurrentDatetime()+" Replication lag monitoring failed: "+lagErr.Error())
+			}
+		}
+		if result.Status == CheckResultRestoreInProgress {
+			fmt.Fprintln(out, getCurrentDatetime()+" restore is in progress, announcement deferred: "+result.Restore.String())
+		}
+		if result.Status == CheckResultCandidate {
+			fmt.Fprintln(out, getCurrentDatetime()+" "+stability.describe(*result.Candidate))
+		}
+		if result.Status == CheckResultAnnounced {
+			fmt.Fprintln(out, getCurrentDatetime()+" DB load detected by "+source)
+			trigger.recordLoad(source, time.Now())
+		}
+		return result, err
+	}
+
+	// scheduled iterations and admin actions never run at the same time
+	lock := newIterationLock()
+	checkIteration := func() (checkResult, error) {
+		_ = lock.lock(context.Background())
+		defer lock.unlock()
+
+		return runCheck(trigger.takeSource())
+	}
+
+	// standby replica refuses admin writes like its checks
+	adminApi := NewAdminApi(out, config, lock, checkStorage, checkEventbus, func() (checkResult, error) {
+		trigger.recordCheck(TriggerSourceAdmin)
+		return runCheck(TriggerSourceAdmin)
+	})
+	if adminApi != nil && !once {
+		adminApi.register(statusServer)
+	}
+
+	if once {
+		return runOnce(out, summaryOut, config.iterationTimeout, checkIteration)
+	}
+
+	errorBudget := NewErrorBudget(config)
+	if errorBudget.enabled() {
+		statusServer.register("errorBudget", errorBudget.status)
+	}
+
+	supervisor := NewSupervisor(out, config, func() error {
+		// iteration abandoned by watchdog could hold the lock forever, recovery is failed then
+		err := lock.lockTimeout(config.iterationTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+
+		eventbus.writer.Close()
+		eventbus.writer = newKafkaWriter(config, auditLog)
+
+		db, err := openSecondaryDekanatDb(config)
+		if err != nil {
+			return classifyError(ConfigInvalidError, hideSecrets(err, config))
+		}
+		secondaryDekanatDb.Close()
+		secondaryDekanatDb = db
+
+		errorBudget.reset()
+		return hideSecrets(selfTest(secondaryDekanatDb, config), config)
+	})
+	if supervisor.enabled() {
+		statusServer.register("supervisor", supervisor.status)
+	}
+
+	return supervisor.run(
+		func(iterationExecutor func() error) error {
+			return runMainLoop(config, out, errorBudget, trigger, statusServer.dump, iterationExecutor)
+		},
+		func() error {
+			_, err := checkIteration()
+			return err
+		},
+	)
+}
+
+// newKafkaWriter - audit (may be nil) receives partition and offset of written messages
+func newKafkaWriter(config Config, audit *AuditLog) *kafka.Writer {
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(config.kafkaHost),
+		Topic:    events.MetaEventsTopic,
+		Balancer: &kafka.LeastBytes{},
+	}
+
+	if audit != nil {
+		writer.Completion = audit.complete
+	}
+
+	if config.kafkaSaslUsername != "" {
+		writer.Transport = &kafka.Transport{
+			SASL: secretSaslPlain{
+				username:     config.kafkaSaslUsername,
+				password:     config.kafkaSaslPassword,
+				passwordFile: config.kafkaSaslPasswordFile,
+			},
+		}
+	}
+
+	return writer
+}
+
+func getEnvFilename() string {
+	if _, err := os.Stat(".env"); err == nil {
+		return ".env"
+	}
+
+	return ""
 }
 
 func handleExitError(errStream io.Writer, err error) int {
-	if err != nil {
+	if err != nil && !errors.Is(err, LoadAnnouncedError) {
 		fmt.Fprintln(errStream, err)
 	}
 
-	if errors.Is(err, TooManyError) {
-		return ExitCodeTooManyErrorInLoop
+	return getExitCode(err)
+}
+
+// getExitCode - error cause has priority over TooManyError, which wraps the last iteration error
+func getExitCode(err error) int {
+	if err == nil {
+		return 0
 	}
 
-	if errors.Is(err, BreakLoopError) {
-		return ExitCodeLoopIsBroken
+	exitCodes := []struct {
+		err  error
+		code int
+	}{
+		{LoadAnnouncedError, ExitCodeLoadAnnounced},
+		{StorageLockedError, ExitCodeStorageIsLocked},
+		{ConfigInvalidError, ExitCodeConfigInvalid},
+		{DbSchemaMismatchError, ExitCodeDbSchemaMismatch},
+		{DbAccessDeniedError, ExitCodeDbAccessDenied},
+		{DbUnreachableError, ExitCodeDbUnreachable},
+		{KafkaUnreachableError, ExitCodeKafkaUnreachable},
+		{StorageUnreadableError, ExitCodeStorageUnreadable},
+		{TooManyError, ExitCodeTooManyErrorInLoop},
+		{BreakLoopError, ExitCodeLoopIsBroken},
 	}
 
-	if err != nil {
-		return ExitCodeMainError
+	for _, exitCode := range exitCodes {
+		if errors.Is(err, exitCode.err) {
+			return exitCode.code
+		}
 	}
 
-	return 0
+	return ExitCodeMainError
 }
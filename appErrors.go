@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var ConfigInvalidError = errors.New("config is invalid")
+var DbUnreachableError = errors.New("secondary Dekanat DB is unreachable")
+var DbSchemaMismatchError = errors.New("secondary Dekanat DB schema mismatch")
+var DbAccessDeniedError = errors.New("secondary Dekanat DB access denied")
+var KafkaUnreachableError = errors.New("kafka is unreachable")
+var StorageUnreadableError = errors.New("storage is unreadable")
+
+// classifiedError adds error class for errors.Is, but keeps original message
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (classified classifiedError) Error() string {
+	return classified.err.Error()
+}
+
+func (classified classifiedError) Unwrap() []error {
+	return []error{classified.class, classified.err}
+}
+
+func classifyError(class error, err error) error {
+	if class == nil || err == nil {
+		return err
+	}
+
+	return classifiedError{class: class, err: err}
+}
+
+// dbErrorClass detects missing tables or columns (Firebird SQL error codes -204, -206),
+// wrong credentials or missing permissions (-551) and connection failures. Class which is already attached is kept,
+// e.g. DbUnreachableError of failed ping.
+func dbErrorClass(err error) error {
+	message := err.Error()
+	if strings.Contains(message, "user name and password are not defined") ||
+		strings.Contains(message, "no permission for") || strings.Contains(message, "SQL error code = -551") {
+		return DbAccessDeniedError
+	}
+
+	if strings.Contains(message, "Table unknown") || strings.Contains(message, "Column unknown") ||
+		strings.Contains(message, "SQL error code = -204") || strings.Contains(message, "SQL error code = -206") {
+		return DbSchemaMismatchError
+	}
+
+	for _, class := range []error{DbAccessDeniedError, DbSchemaMismatchError, DbUnreachableError} {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+
+	if isConnectionLostError(err) {
+		return DbUnreachableError
+	}
+
+	return nil
+}
+
+// connectionLostMessages - Firebird errors of broken connection, e.g. after server restart
+var connectionLostMessages = []string{
+	"connection shutdown",
+	"Error reading data from the connection",
+	"Error writing data to the connection",
+	"Unable to complete network request",
+}
+
+func isConnectionLostError(err error) bool {
+	var netError net.Error
+	if errors.As(err, &netError) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	message := err.Error()
+	for _, connectionLostMessage := range connectionLostMessages {
+		if strings.Contains(message, connectionLostMessage) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Run("Keep message and chain", func(t *testing.T) {
+		originalErr := errors.New("dummy error")
+		err := classifyError(KafkaUnreachableError, originalErr)
+
+		assert.Equal(t, "dummy error", err.Error())
+		assert.ErrorIs(t, err, KafkaUnreachableError)
+		assert.ErrorIs(t, err, originalErr)
+	})
+
+	t.Run("Without class", func(t *testing.T) {
+		originalErr := errors.New("dummy error")
+
+		assert.Equal(t, originalErr, classifyError(nil, originalErr))
+		assert.NoError(t, classifyError(KafkaUnreachableError, nil))
+	})
+}
+
+func TestDbErrorClass(t *testing.T) {
+	testCases := map[error]error{
+		errors.New("Dynamic SQL Error\nSQL error code = -204\nTable unknown\nTSESS_LOG"): DbSchemaMismatchError,
+		errors.New("Dynamic SQL Error\nSQL error code = -206\nColumn unknown\nCON_DATA"): DbSchemaMismatchError,
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}:      DbUnreachableError,
+		driver.ErrBadConn: DbUnreachableError,
+		errors.New("Your user name and password are not defined. Ask your database administrator to set up a Firebird login."): DbAccessDeniedError,
+		errors.New("no permission for SELECT access to TABLE TSESS_LOG\nSQL error code = -551"):                                DbAccessDeniedError,
+		errors.New("cannot parse string"): nil,
+		classifyError(DbUnreachableError, errors.New("I/O error during \"open\" operation for file \"/data/dekanat.fdb\"")): DbUnreachableError,
+	}
+
+	for err, expectedClass := range testCases {
+		assert.Equalf(t, expectedClass, dbErrorClass(err), "Wrong class for %s", err)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
@@ -16,15 +18,71 @@ func TestRunApp(t *testing.T) {
 		_ = os.Setenv("PAUSE_AFTER_SUCCESS", "1")
 		_ = os.Setenv("PAUSE_AFTER_ERROR", "1")
 		_ = os.Setenv("ERROR_COUNT_TO_BREAK", "1")
+		defer os.Remove(expectedConfig.storageFile + ".lock")
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 		output := out.String()
 
 		assert.ErrorIs(t, err, TooManyError, "Expected for TooManyError, got %s", err)
 		assert.Containsf(t, output, "Failed to get last datetime from DB", "Expected for Dekanat DB connect error: got: %s", output)
 	})
 
+	t.Run("Run once with mock config", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+		_ = os.Setenv("STORAGE_FILE", expectedConfig.storageFile)
+		defer os.Remove(expectedConfig.storageFile + ".lock")
+
+		var out, summary bytes.Buffer
+		err := runApp(&out, &summary)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to get last datetime from DB")
+		assert.Contains(t, summary.String(), `"Result":"error"`)
+		assert.Equal(t, 1, bytes.Count(summary.Bytes(), []byte("\n")), "summary output has only summary line")
+		assert.NotContains(t, out.String(), `"Result"`)
+		assert.Equal(t, ExitCodeDbUnreachable, handleExitError(&bytes.Buffer{}, err))
+	})
+
+	t.Run("Run with termination log", func(t *testing.T) {
+		terminationLog := t.TempDir() + "/termination-log"
+		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+		_ = os.Setenv("STORAGE_FILE", expectedConfig.storageFile)
+		_ = os.Setenv("TERMINATION_LOG", terminationLog)
+		defer os.Unsetenv("TERMINATION_LOG")
+		defer os.Remove(expectedConfig.storageFile + ".lock")
+
+		var out bytes.Buffer
+		err := runApp(&out, nil)
+
+		assert.ErrorIs(t, err, TooManyError)
+		assert.ErrorIs(t, err, DbUnreachableError)
+
+		var report terminationReportContent
+		content, _ := os.ReadFile(terminationLog)
+		assert.NoError(t, json.Unmarshal(content, &report))
+		assert.Equal(t, ExitCodeDbUnreachable, report.ExitCode)
+		assert.Len(t, report.LastErrors, 1)
+		assert.Contains(t, report.LastErrors[0].Error, "Failed to get last datetime from DB")
+	})
+
+	t.Run("Run with invalid config and termination log", func(t *testing.T) {
+		terminationLog := t.TempDir() + "/termination-log"
+		_ = os.Setenv("KAFKA_HOST", "")
+		_ = os.Setenv("TERMINATION_LOG", terminationLog)
+		defer os.Unsetenv("TERMINATION_LOG")
+		defer os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+
+		var out bytes.Buffer
+		err := runApp(&out, nil)
+
+		assert.ErrorIs(t, err, ConfigInvalidError)
+		assert.Equal(t, ExitCodeConfigInvalid, getExitCode(err))
+		assert.FileExists(t, terminationLog)
+	})
+
 	t.Run("Run with wrong env file", func(t *testing.T) {
 		previousWd, err := os.Getwd()
 		assert.NoErrorf(t, err, "Failed to get working dir: %s", err)
@@ -50,7 +108,7 @@ func TestRunApp(t *testing.T) {
 		assert.NoErrorf(t, err, "Failed to change working dir: %s", err)
 
 		var out bytes.Buffer
-		err = runApp(&out)
+		err = runApp(&out, nil)
 		assert.Error(t, err, "Expected for error")
 		assert.Containsf(
 			t, err.Error(), "Failed to load config",
@@ -63,7 +121,7 @@ func TestRunApp(t *testing.T) {
 		defer os.Unsetenv("DEKANAT_DB_DRIVER_NAME")
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 
 		expectedError := "Wrong connection configuration for secondary Dekanat DB: sql: unknown driver \"dummy-not-exist\" (forgotten import?)"
 
@@ -74,19 +132,42 @@ func TestRunApp(t *testing.T) {
 	t.Run("Run with wrong storage file", func(t *testing.T) {
 		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
 		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
-		_ = os.Setenv("STORAGE_FILE", os.TempDir())
+		// directory instead of file
+		storageDir := os.TempDir() + "/secondary-db-watcher-storage-dir"
+		_ = os.Mkdir(storageDir, os.ModePerm)
+		defer os.Remove(storageDir)
+		defer os.Remove(storageDir + ".lock")
+
+		_ = os.Setenv("STORAGE_FILE", storageDir)
 		_ = os.Setenv("PAUSE_AFTER_SUCCESS", "1")
 		_ = os.Setenv("PAUSE_AFTER_ERROR", "1")
 		_ = os.Setenv("ERROR_COUNT_TO_BREAK", "1")
 
 		var out bytes.Buffer
-		err := runApp(&out)
+		err := runApp(&out, nil)
 		assert.Error(t, err, "Expected for error")
 		assert.Containsf(
 			t, err.Error(), "Failed to load storage file",
 			"Expected for Failed to load storage file, got: %s", err,
 		)
 	})
+
+	t.Run("Run with locked storage file", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+		_ = os.Setenv("STORAGE_FILE", expectedConfig.storageFile)
+		defer os.Remove(expectedConfig.storageFile + ".lock")
+
+		storageLock, err := lockStorage(expectedConfig.storageFile)
+		assert.NoError(t, err)
+		defer storageLock.unlock()
+
+		var out bytes.Buffer
+		err = runApp(&out, nil)
+
+		assert.ErrorIs(t, err, StorageLockedError)
+		assert.Contains(t, err.Error(), "locked by PID")
+	})
 }
 
 func TestHandleExitError(t *testing.T) {
@@ -98,7 +179,17 @@ func TestHandleExitError(t *testing.T) {
 			errors.New("dummy error"): ExitCodeMainError,
 			TooManyError:              ExitCodeTooManyErrorInLoop,
 			BreakLoopError:            ExitCodeLoopIsBroken,
-			nil:                       0,
+			StorageLockedError:        ExitCodeStorageIsLocked,
+			LoadAnnouncedError:        ExitCodeLoadAnnounced,
+			ConfigInvalidError:        ExitCodeConfigInvalid,
+			DbUnreachableError:        ExitCodeDbUnreachable,
+			DbSchemaMismatchError:     ExitCodeDbSchemaMismatch,
+			DbAccessDeniedError:       ExitCodeDbAccessDenied,
+			KafkaUnreachableError:     ExitCodeKafkaUnreachable,
+			StorageUnreadableError:    ExitCodeStorageUnreadable,
+			fmt.Errorf("%w: %w", TooManyError, classifyError(DbUnreachableError, errors.New("dummy"))):    ExitCodeDbUnreachable,
+			fmt.Errorf("%w: %w", PermanentError, classifyError(DbAccessDeniedError, errors.New("dummy"))): ExitCodeDbAccessDenied,
+			nil: 0,
 		}
 
 		for err, expectedCode := range testCases {
@@ -110,7 +201,7 @@ func TestHandleExitError(t *testing.T) {
 				"Expect handleExitError(%v) = %d, actual: %d",
 				err, expectedCode, actualExitCode,
 			)
-			if err == nil {
+			if err == nil || err == LoadAnnouncedError {
 				assert.Empty(t, out.String(), "Error is not empty")
 			} else {
 				assert.Contains(t, out.String(), err.Error(), "error output hasn't error description")
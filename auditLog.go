@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditLog - append-only JSONL record of every announcement (SecondaryDbLoadedEvent and CurrentYearEvent)
+// with Kafka partition and offset or error. File is rotated by size to "<file>.1" (newest) ... "<file>.N".
+type AuditLog struct {
+	file        string
+	maxSize     int64
+	backupCount int
+	host        string
+
+	mutex sync.Mutex
+	// delivered - messages with partition and offset from kafka.Writer Completion
+	delivered []kafka.Message
+}
+
+type auditRecord struct {
+	Time        time.Time
+	Host        string
+	Event       string
+	Payload     json.RawMessage
+	Headers     map[string]string `json:",omitempty"`
+	Partition   *int              `json:",omitempty"`
+	Offset      *int64            `json:",omitempty"`
+	Error       string            `json:",omitempty"`
+	StateBefore dbState
+	StateAfter  dbState
+}
+
+// NewAuditLog returns nil when AUDIT_LOG is not configured
+func NewAuditLog(config Config) *AuditLog {
+	if config.auditLog == "" {
+		return nil
+	}
+
+	host, _ := os.Hostname()
+	return &AuditLog{
+		file:        config.auditLog,
+		maxSize:     int64(config.auditLogMaxSize) * 1024 * 1024,
+		backupCount: config.auditLogBackupCount,
+		host:        host,
+	}
+}
+
+// complete is kafka.Writer Completion, synchronous writer calls it before WriteMessages returns
+func (audit *AuditLog) complete(messages []kafka.Message, err error) {
+	if err != nil {
+		return
+	}
+
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+
+	audit.delivered = append(audit.delivered, messages...)
+}
+
+func (audit *AuditLog) record(message kafka.Message, transition stateTransition, err error) error {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+
+	record := auditRecord{
+		Time:        time.Now(),
+		Host:        audit.host,
+		Event:       string(message.Key),
+		Payload:     message.Value,
+		StateBefore: transition.Before,
+		StateAfter:  transition.After,
+	}
+
+	if len(message.Headers) != 0 {
+		record.Headers = map[string]string{}
+		for _, header := range message.Headers {
+			record.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	for _, delivered := range audit.delivered {
+		if bytes.Equal(delivered.Key, message.Key) && bytes.Equal(delivered.Value, message.Value) {
+			record.Partition = &delivered.Partition
+			record.Offset = &delivered.Offset
+		}
+	}
+	audit.delivered = nil
+
+	line, _ := json.Marshal(record)
+	return audit.append(append(line, '\n'))
+}
+
+// append writes line to the end of audit log, file is rotated before it exceeds maxSize
+func (audit *AuditLog) append(line []byte) error {
+	info, err := os.Stat(audit.file)
+	if err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > audit.maxSize {
+		err = audit.rotate()
+		if err != nil {
+			return errors.New("failed to rotate audit log: " + err.Error())
+		}
+	}
+
+	file, err := os.OpenFile(audit.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(line)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (audit *AuditLog) rotate() error {
+	_ = os.Remove(auditLogFile(audit.file, audit.backupCount))
+	for i := audit.backupCount - 1; i >= 1; i-- {
+		err := os.Rename(auditLogFile(audit.file, i), auditLogFile(audit.file, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(audit.file, auditLogFile(audit.file, 1))
+}
+
+// auditLogFile returns rotated file name, index 0 is the current file
+func auditLogFile(file string, index int) string {
+	if index == 0 {
+		return file
+	}
+
+	return fmt.Sprintf("%s.%d", file, index)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/kneu-messenger-pigeon/events/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAuditRecords(t *testing.T, file string) []auditRecord {
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record auditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	transition := stateTransition{
+		Before: dbState{ActualDatetime: time.Date(2023, 9, 1, 4, 0, 0, 0, time.UTC), EducationYear: 2023},
+		After:  dbState{ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, time.UTC), EducationYear: 2023},
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewAuditLog(Config{}))
+	})
+
+	t.Run("Delivered event with partition and offset", func(t *testing.T) {
+		file := t.TempDir() + "/audit.jsonl"
+		audit := NewAuditLog(Config{auditLog: file, auditLogMaxSize: 1, auditLogBackupCount: 2})
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			message := args.Get(1).(kafka.Message)
+			message.Partition = 3
+			message.Offset = 42
+			audit.complete([]kafka.Message{message}, nil)
+		})
+
+		eventbus := MetaEventbus{writer: writer, out: &bytes.Buffer{}, audit: audit}
+		err := eventbus.sendSecondaryDbLoadedEvent(transition.After.ActualDatetime, transition.Before.ActualDatetime, 2023, loadDetails{
+			Sessions:   loadSessions{Count: 1, FirstDatetime: transition.After.ActualDatetime, LastDatetime: transition.After.ActualDatetime},
+			Transition: transition,
+		})
+		assert.NoError(t, err)
+
+		records := readAuditRecords(t, file)
+		assert.Len(t, records, 1)
+		assert.Equal(t, events.SecondaryDbLoadedEventName, records[0].Event)
+		assert.Contains(t, string(records[0].Payload), `"CurrentSecondaryDatabaseDatetime":"2023-09-02T04:00:00Z"`)
+		assert.Equal(t, "1", records[0].Headers["sessionCount"])
+		assert.Equal(t, 3, *records[0].Partition)
+		assert.Equal(t, int64(42), *records[0].Offset)
+		assert.Empty(t, records[0].Error)
+		assert.True(t, transition.Before.ActualDatetime.Equal(records[0].StateBefore.ActualDatetime))
+		assert.True(t, transition.After.ActualDatetime.Equal(records[0].StateAfter.ActualDatetime))
+		assert.NotEmpty(t, records[0].Host)
+	})
+
+	t.Run("Failed event with error", func(t *testing.T) {
+		file := t.TempDir() + "/audit.jsonl"
+		audit := NewAuditLog(Config{auditLog: file, auditLogMaxSize: 1, auditLogBackupCount: 2})
+		expectedError := errors.New("kafka is down")
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), mock.Anything).Return(expectedError)
+
+		eventbus := MetaEventbus{writer: writer, out: &bytes.Buffer{}, audit: audit}
+		err := eventbus.sendCurrentYearEvent(2023, transition)
+		assert.Equal(t, expectedError, err)
+
+		records := readAuditRecords(t, file)
+		assert.Len(t, records, 1)
+		assert.Equal(t, events.CurrentYearEventName, records[0].Event)
+		assert.JSONEq(t, `{"Year":2023}`, string(records[0].Payload))
+		assert.Nil(t, records[0].Partition)
+		assert.Nil(t, records[0].Offset)
+		assert.Equal(t, expectedError.Error(), records[0].Error)
+	})
+
+	t.Run("Failed audit record does not fail event", func(t *testing.T) {
+		audit := NewAuditLog(Config{auditLog: t.TempDir() + "/missing/audit.jsonl", auditLogMaxSize: 1})
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), mock.Anything).Return(nil)
+
+		out := &bytes.Buffer{}
+		eventbus := MetaEventbus{writer: writer, out: out, audit: audit}
+		err := eventbus.sendCurrentYearEvent(2023, transition)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "Failed to write audit record: ")
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		file := t.TempDir() + "/audit.jsonl"
+		audit := NewAuditLog(Config{auditLog: file, auditLogBackupCount: 2})
+		audit.maxSize = 1
+
+		for year := 2021; year <= 2024; year++ {
+			message := kafka.Message{Key: []byte(events.CurrentYearEventName), Value: []byte(`{"Year":` + strconv.Itoa(year) + `}`)}
+			assert.NoError(t, audit.record(message, transition, nil))
+		}
+
+		assert.JSONEq(t, `{"Year":2024}`, string(readAuditRecords(t, file)[0].Payload))
+		assert.JSONEq(t, `{"Year":2023}`, string(readAuditRecords(t, file+".1")[0].Payload))
+		assert.JSONEq(t, `{"Year":2022}`, string(readAuditRecords(t, file+".2")[0].Payload))
+		assert.NoFileExists(t, file+".3")
+	})
+}
+
+func TestRunAuditSearch(t *testing.T) {
+	file := t.TempDir() + "/audit.jsonl"
+
+	// DB and Kafka settings are not required for search
+	_ = os.Unsetenv("KAFKA_HOST")
+	_ = os.Unsetenv("SECONDARY_DEKANAT_DB_DSN")
+	_ = os.Setenv("AUDIT_LOG", file)
+	defer os.Unsetenv("AUDIT_LOG")
+
+	_ = os.WriteFile(file+".3", []byte(
+		`{"Time":"2022-09-01T04:00:00Z","Event":"CurrentYearEvent","Payload":{"Year":2022}}`+"\n",
+	), 0640)
+	_ = os.WriteFile(file+".1", []byte(
+		`{"Time":"2023-09-01T04:00:00Z","Event":"CurrentYearEvent","Payload":{"Year":2023}}`+"\n"+
+			`{"Time":"2023-09-01T04:00:01Z","Event":"SecondaryDbLoadedEvent","Payload":{"Year":2023},"Offset":7}`+"\n",
+	), 0640)
+	_ = os.WriteFile(file, []byte(
+		`{"Time":"2024-09-01T04:00:00Z","Event":"CurrentYearEvent","Payload":{"Year":2024},"Error":"kafka is down"}`+"\n"+
+			"not a json\n",
+	), 0640)
+
+	t.Run("All records oldest first", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"audit", "search"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Contains(t, output, "found 3 records", "rotated files are scanned while numbering is continuous")
+		assert.Less(t, strings.Index(output, `"Year":2023`), strings.Index(output, `"Year":2024`))
+	})
+
+	t.Run("Rotated files beyond backup count", func(t *testing.T) {
+		_ = os.WriteFile(file+".2", []byte(
+			`{"Time":"2022-10-01T04:00:00Z","Event":"CurrentYearEvent","Payload":{"Year":2022}}`+"\n",
+		), 0640)
+		defer os.Remove(file + ".2")
+		_ = os.Setenv("AUDIT_LOG_BACKUP_COUNT", "1")
+		defer os.Unsetenv("AUDIT_LOG_BACKUP_COUNT")
+
+		var out bytes.Buffer
+		err := runCommand([]string{"audit", "search", "-year", "2022"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Contains(t, output, "found 2 records")
+		assert.Less(t, strings.Index(output, `"2022-09-01T04:00:00Z"`), strings.Index(output, `"2022-10-01T04:00:00Z"`))
+	})
+
+	t.Run("File flag", func(t *testing.T) {
+		_ = os.Unsetenv("AUDIT_LOG")
+		defer os.Setenv("AUDIT_LOG", file)
+
+		var out bytes.Buffer
+		err := runCommand([]string{"audit", "search", "-file", file, "-event", events.SecondaryDbLoadedEventName}, &out)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), `"Offset":7`)
+		assert.Contains(t, out.String(), "found 1 records")
+	})
+
+	t.Run("Filter by event and year", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"audit", "search", "-event", events.CurrentYearEventName, "-year", "2023"}, &out)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), `"Time":"2023-09-01T04:00:00Z"`)
+		assert.Contains(t, out.String(), "found 1 records")
+	})
+
+	t.Run("Filter by range and substring", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"audit", "search", "-from", "2023-09-01T04:00:01Z", "-to", "2024-12-31T00:00:00Z", "-contains", "kafka is down"}, &out)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), `"Year":2024`)
+		assert.Contains(t, out.String(), "found 1 records")
+	})
+
+	t.Run("Wrong range", func(t *testing.T) {
+		err := runCommand([]string{"audit", "search", "-from", "yesterday"}, &bytes.Buffer{})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "wrong audit search range")
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		_ = os.Unsetenv("AUDIT_LOG")
+		defer os.Setenv("AUDIT_LOG", file)
+
+		err := runCommand([]string{"audit", "search"}, &bytes.Buffer{})
+
+		assert.EqualError(t, err, "AUDIT_LOG is not configured, use -file")
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// auditSearchFilter - empty fields match any record
+type auditSearchFilter struct {
+	event    string
+	year     int
+	from     time.Time
+	to       time.Time
+	contains string
+}
+
+// runAuditSearch prints matched audit records from rotated and current audit log files, oldest first.
+// Only AUDIT_LOG is read from config, so search works without DB and Kafka settings.
+func runAuditSearch(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("audit search", flag.ContinueOnError)
+	flags.SetOutput(out)
+	event := flags.String("event", "", "event name, e.g. "+events.CurrentYearEventName)
+	year := flags.Int("year", 0, "education year of event payload")
+	from := flags.String("from", "", "records since datetime, RFC3339")
+	to := flags.String("to", "", "records till datetime, RFC3339")
+	contains := flags.String("contains", "", "substring of JSON record")
+	file := flags.String("file", "", "audit log file, AUDIT_LOG by default")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		reader, err := newConfigReader(getEnvFilename())
+		if err != nil {
+			return errors.New("Failed to load config: " + err.Error())
+		}
+		*file = reader.string("AUDIT_LOG")
+	}
+	if *file == "" {
+		return errors.New("AUDIT_LOG is not configured, use -file")
+	}
+
+	filter := auditSearchFilter{event: *event, year: *year, contains: *contains}
+	if *from != "" {
+		filter.from, err = time.Parse(StorageTimeFormat, *from)
+	}
+	if err == nil && *to != "" {
+		filter.to, err = time.Parse(StorageTimeFormat, *to)
+	}
+	if err != nil {
+		return errors.New("wrong audit search range: " + err.Error())
+	}
+
+	// rotated files are found without AUDIT_LOG_BACKUP_COUNT, it could be changed after rotation
+	lastIndex := 0
+	for {
+		if _, err := os.Stat(auditLogFile(*file, lastIndex+1)); err != nil {
+			break
+		}
+		lastIndex++
+	}
+
+	found := 0
+	for index := lastIndex; index >= 0; index-- {
+		count, err := searchAuditLogFile(auditLogFile(*file, index), filter, out)
+		if err != nil {
+			return err
+		}
+		found += count
+	}
+
+	fmt.Fprintf(out, "found %d records\n", found)
+	return nil
+}
+
+func searchAuditLogFile(file string, filter auditSearchFilter, out io.Writer) (int, error) {
+	handle, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+
+	found := 0
+	scanner := bufio.NewScanner(handle)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if filter.match(line) {
+			fmt.Fprintln(out, line)
+			found++
+		}
+	}
+
+	return found, scanner.Err()
+}
+
+func (filter auditSearchFilter) match(line string) bool {
+	var record auditRecord
+	if json.Unmarshal([]byte(line), &record) != nil {
+		return false
+	}
+
+	var payload struct{ Year int }
+	_ = json.Unmarshal(record.Payload, &payload)
+
+	return (filter.event == "" || record.Event == filter.event) &&
+		(filter.year == 0 || payload.Year == filter.year) &&
+		(filter.from.IsZero() || !record.Time.Before(filter.from)) &&
+		(filter.to.IsZero() || !record.Time.After(filter.to)) &&
+		(filter.contains == "" || strings.Contains(line, filter.contains))
+}
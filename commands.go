@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const maskedSecret = "******"
+
+func runCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return runApp(out, nil)
+	}
+
+	if len(args) == 1 && (args[0] == "--once" || args[0] == "-once") {
+		// stdout has only JSON summary, logs are written to stderr
+		return runApp(os.Stderr, out)
+	}
+
+	if len(args) == 2 && args[0] == "config" && args[1] == "print" {
+		return runConfigPrint(out)
+	}
+
+	if len(args) >= 2 && args[0] == "audit" && args[1] == "search" {
+		return runAuditSearch(args[2:], out)
+	}
+
+	if args[0] == "replay" {
+		return runReplay(args[1:], out)
+	}
+
+	return errors.New("Unknown command: " + strings.Join(args, " "))
+}
+
+func runConfigPrint(out io.Writer) error {
+	config, err := loadConfig(getEnvFilename())
+	if err != nil {
+		return errors.New("Failed to load config: " + err.Error())
+	}
+
+	printConfig(out, config)
+	return nil
+}
+
+func printConfig(out io.Writer, config Config) {
+	values := [][2]string{
+		{"DEKANAT_DB_DRIVER_NAME", config.dekanatDbDriverName},
+		{"SECONDARY_DEKANAT_DB_DSN", maskDsn(config.secondaryDekanatDbDSN)},
+		{"SECONDARY_DEKANAT_DB_DSN_FILE", config.secondaryDekanatDbDSNFile},
+		{"SECONDARY_DEKANAT_DB_EVENT_NAME", config.secondaryDekanatDbEventName},
+		{"SECONDARY_DEKANAT_DB_MAX_OPEN_CONNS", fmt.Sprint(config.secondaryDekanatDbMaxOpenConns)},
+		{"SECONDARY_DEKANAT_DB_CONN_MAX_LIFETIME", fmt.Sprint(int(config.secondaryDekanatDbConnMaxLifetime.Seconds()))},
+		{"SECONDARY_DEKANAT_DB_CONN_MAX_IDLE_TIME", fmt.Sprint(int(config.secondaryDekanatDbConnMaxIdleTime.Seconds()))},
+		{"SECONDARY_DEKANAT_DB_FILE", config.secondaryDekanatDbFile},
+		{"SECONDARY_DEKANAT_DB_FILE_SETTLE_TIME", fmt.Sprint(int(config.secondaryDekanatDbFileSettleTime.Seconds()))},
+		{"SECONDARY_DEKANAT_DB_FILE_POLL_INTERVAL", fmt.Sprint(int(config.secondaryDekanatDbFilePollInterval.Seconds()))},
+		{"READ_ONLY_CHECK", config.readOnlyCheck},
+		{"PRIMARY_DEKANAT_DB_DSN", maskDsn(config.primaryDekanatDbDSN)},
+		{"PRIMARY_DEKANAT_DB_DSN_FILE", config.primaryDekanatDbDSNFile},
+		{"REPLICATION_LAG_THRESHOLD", fmt.Sprint(int(config.replicationLagThreshold.Seconds()))},
+		{"KAFKA_HOST", config.kafkaHost},
+		{"KAFKA_SASL_USERNAME", config.kafkaSaslUsername},
+		{"KAFKA_SASL_PASSWORD", maskSecret(config.kafkaSaslPassword)},
+		{"KAFKA_SASL_PASSWORD_FILE", config.kafkaSaslPasswordFile},
+		{"STORAGE_FILE", config.storageFile},
+		{"STORAGE_BACKUP_COUNT", fmt.Sprint(config.storageBackupCount)},
+		{"PAUSE_AFTER_SUCCESS", fmt.Sprint(int(config.pauseAfterSuccess.Seconds()))},
+		{"PAUSE_AFTER_ERROR", fmt.Sprint(int(config.pauseAfterError.Seconds()))},
+		{"ERROR_COUNT_TO_BREAK", fmt.Sprint(config.errorCountToBreak)},
+		{"ITERATION_TIMEOUT", fmt.Sprint(int(config.iterationTimeout.Seconds()))},
+		{"STABILITY_CHECKS", fmt.Sprint(config.stabilityChecks)},
+		{"STABILITY_QUIET_PERIOD", fmt.Sprint(int(config.stabilityQuietPeriod.Seconds()))},
+		{"RESTORE_LOADER_USERS", strings.Join(config.restoreLoaderUsers, ",")},
+		{"RESTORE_LOADER_PROCESSES", strings.Join(config.restoreLoaderProcesses, ",")},
+		{"RESTORE_WRITE_TRANSACTION_AGE", fmt.Sprint(int(config.restoreWriteTransactionAge.Seconds()))},
+		{"ERROR_COUNT_TO_BREAK_DATABASE", fmt.Sprint(config.getErrorCountToBreak(ErrorCategoryDatabase))},
+		{"ERROR_COUNT_TO_BREAK_STORAGE", fmt.Sprint(config.getErrorCountToBreak(ErrorCategoryStorage))},
+		{"ERROR_COUNT_TO_BREAK_EVENTBUS", fmt.Sprint(config.getErrorCountToBreak(ErrorCategoryEventbus))},
+		{"ERROR_WINDOW_MAX_ERRORS", fmt.Sprint(config.errorWindowMaxErrors)},
+		{"ERROR_WINDOW_DURATION", fmt.Sprint(int(config.errorWindowDuration.Seconds()))},
+		{"ERROR_WINDOW_ITERATIONS", fmt.Sprint(config.errorWindowIterations)},
+		{"SUPERVISOR_MAX_RECOVERIES", fmt.Sprint(config.supervisorMaxRecoveries)},
+		{"TERMINATION_LOG", config.terminationLog},
+		{"STATUS_LISTEN", config.statusListen},
+		{"AUDIT_LOG", config.auditLog},
+		{"AUDIT_LOG_MAX_SIZE", fmt.Sprint(config.auditLogMaxSize)},
+		{"AUDIT_LOG_BACKUP_COUNT", fmt.Sprint(config.auditLogBackupCount)},
+		{"ADMIN_TOKEN", maskSecret(config.adminToken)},
+		{"ADMIN_TOKEN_FILE", config.adminTokenFile},
+		{"LEADER_ELECTION_LEASE_FILE", config.leaderElectionLeaseFile},
+		{"LEADER_ELECTION_LEASE_DURATION", fmt.Sprint(int(config.leaderElectionLeaseDuration.Seconds()))},
+		{"LEADER_ELECTION_IDENTITY", config.leaderElectionIdentity},
+	}
+
+	for _, value := range values {
+		fmt.Fprintf(out, "%s=%s\n", value[0], value[1])
+	}
+
+	for _, warning := range config.warnings {
+		fmt.Fprintln(out, "# WARNING: "+warning)
+	}
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return maskedSecret
+}
+
+// maskDsn hides password in DSN like "USER:PASSWORD@HOST/DATABASE"
+func maskDsn(dsn string) string {
+	password := dsnPassword(dsn)
+	if password == "" {
+		return dsn
+	}
+
+	colon := strings.Index(dsn, ":")
+	return dsn[:colon+1] + maskedSecret + dsn[colon+1+len(password):]
+}
+
+func dsnPassword(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at == -1 {
+		return ""
+	}
+
+	colon := strings.Index(dsn[:at], ":")
+	if colon == -1 {
+		return ""
+	}
+
+	return dsn[colon+1 : at]
+}
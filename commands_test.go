@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	t.Run("Config print", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+
+		var out bytes.Buffer
+		err := runCommand([]string{"config", "print"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Contains(t, output, "KAFKA_HOST="+expectedConfig.kafkaHost+"\n")
+		assert.Contains(t, output, "SECONDARY_DEKANAT_DB_DSN=USER:"+maskedSecret+"@HOST/DATABASE\n")
+		assert.NotContains(t, output, "PASSOWORD")
+	})
+
+	t.Run("Config print with invalid value warning", func(t *testing.T) {
+		_ = os.Setenv("STORAGE_BACKUP_COUNT", "three")
+		defer os.Unsetenv("STORAGE_BACKUP_COUNT")
+
+		var out bytes.Buffer
+		err := runCommand([]string{"config", "print"}, &out)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "STORAGE_BACKUP_COUNT=3\n")
+		assert.Contains(t, out.String(), `# WARNING: invalid STORAGE_BACKUP_COUNT value "three"`)
+	})
+
+	t.Run("Config print with invalid config", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", "")
+		defer os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+
+		var out bytes.Buffer
+		err := runCommand([]string{"config", "print"}, &out)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to load config")
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("Unknown command", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"dummy"}, &out)
+
+		assert.Error(t, err)
+		assert.Equal(t, "Unknown command: dummy", err.Error())
+	})
+}
+
+func TestMaskDsn(t *testing.T) {
+	testCases := map[string]string{
+		"USER:PASSWORD@HOST/DATABASE":        "USER:" + maskedSecret + "@HOST/DATABASE",
+		"USER:P@SS:WORD@HOST:3050/DB":        "USER:" + maskedSecret + "@HOST:3050/DB",
+		"USER@HOST/DATABASE":                 "USER@HOST/DATABASE",
+		"/var/lib/firebird/data/dekanat.fdb": "/var/lib/firebird/data/dekanat.fdb",
+	}
+
+	for dsn, expected := range testCases {
+		assert.Equalf(t, expected, maskDsn(dsn), "Expected maskDsn(%s) = %s", dsn, expected)
+	}
+}
@@ -4,69 +4,424 @@ import (
 	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	dekanatDbDriverName   string
-	kafkaHost             string
-	secondaryDekanatDbDSN string
-	storageFile           string
-	pauseAfterSuccess     time.Duration
-	pauseAfterError       time.Duration
-	errorCountToBreak     int
+	dekanatDbDriverName       string
+	kafkaHost                 string
+	kafkaSaslUsername         string
+	kafkaSaslPassword         string
+	kafkaSaslPasswordFile     string
+	secondaryDekanatDbDSN     string
+	secondaryDekanatDbDSNFile string
+	// secondaryDekanatDbEventName - Firebird POST_EVENT name which triggers DB check immediately
+	secondaryDekanatDbEventName string
+	// secondaryDekanatDb* - connection pool settings
+	secondaryDekanatDbMaxOpenConns    int
+	secondaryDekanatDbConnMaxLifetime time.Duration
+	secondaryDekanatDbConnMaxIdleTime time.Duration
+	// secondaryDekanatDbFile - optional database file, its modification triggers DB check after settle time
+	secondaryDekanatDbFile             string
+	secondaryDekanatDbFileSettleTime   time.Duration
+	secondaryDekanatDbFilePollInterval time.Duration
+	// readOnlyCheck - action when secondary DB credentials have write access: refuse, warn or off
+	readOnlyCheck string
+	// primaryDekanatDb* - optional primary DB for replication lag monitoring
+	primaryDekanatDbDSN     string
+	primaryDekanatDbDSNFile string
+	// replicationLagThreshold - lag after which ReplicationLagExceededEvent is sent, 0 disables event
+	replicationLagThreshold time.Duration
+	storageFile             string
+	storageBackupCount      int
+	pauseAfterSuccess       time.Duration
+	pauseAfterError         time.Duration
+	errorCountToBreak       int
+	iterationTimeout        time.Duration
+	// stability* - announce new state only after it is unchanged during N checks or quiet period
+	stabilityChecks      int
+	stabilityQuietPeriod time.Duration
+	// restore* - in-progress restore detection by MON$ATTACHMENTS and MON$TRANSACTIONS
+	restoreLoaderUsers         []string
+	restoreLoaderProcesses     []string
+	restoreWriteTransactionAge time.Duration
+	// errorCountToBreakByCategory - budgets for transient errors by category, errorCountToBreak is used by default
+	errorCountToBreakByCategory map[string]int
+	// errorWindow* - optional windowed error policy instead of consecutive error count
+	errorWindowMaxErrors  int
+	errorWindowDuration   time.Duration
+	errorWindowIterations int
+	// supervisorMaxRecoveries - failed in-process recovery cycles before exit, 0 disables supervisor
+	supervisorMaxRecoveries int
+
+	terminationLog string
+	statusListen   string
+	// auditLog - optional JSONL audit log of announcements, rotated after auditLogMaxSize megabytes
+	auditLog            string
+	auditLogMaxSize     int
+	auditLogBackupCount int
+	// adminToken - bearer token of admin API on status server, empty disables admin API
+	adminToken                  string
+	adminTokenFile              string
+	leaderElectionLeaseFile     string
+	leaderElectionLeaseDuration time.Duration
+	leaderElectionIdentity      string
+
+	// warnings - invalid values replaced by defaults in non-strict mode
+	warnings []string
+}
+
+// configKeys - every known config option. Config file keys are the same names in lower case.
+var configKeys = []string{
+	"CONFIG_FILE",
+	"CONFIG_STRICT",
+	"DEKANAT_DB_DRIVER_NAME",
+	"SECONDARY_DEKANAT_DB_DSN",
+	"SECONDARY_DEKANAT_DB_DSN_FILE",
+	"SECONDARY_DEKANAT_DB_EVENT_NAME",
+	"SECONDARY_DEKANAT_DB_MAX_OPEN_CONNS",
+	"SECONDARY_DEKANAT_DB_CONN_MAX_LIFETIME",
+	"SECONDARY_DEKANAT_DB_CONN_MAX_IDLE_TIME",
+	"SECONDARY_DEKANAT_DB_FILE",
+	"SECONDARY_DEKANAT_DB_FILE_SETTLE_TIME",
+	"SECONDARY_DEKANAT_DB_FILE_POLL_INTERVAL",
+	"READ_ONLY_CHECK",
+	"PRIMARY_DEKANAT_DB_DSN",
+	"PRIMARY_DEKANAT_DB_DSN_FILE",
+	"REPLICATION_LAG_THRESHOLD",
+	"KAFKA_HOST",
+	"KAFKA_SASL_USERNAME",
+	"KAFKA_SASL_PASSWORD",
+	"KAFKA_SASL_PASSWORD_FILE",
+	"STORAGE_FILE",
+	"STORAGE_BACKUP_COUNT",
+	"PAUSE_AFTER_SUCCESS",
+	"PAUSE_AFTER_ERROR",
+	"ERROR_COUNT_TO_BREAK",
+	"ITERATION_TIMEOUT",
+	"STABILITY_CHECKS",
+	"STABILITY_QUIET_PERIOD",
+	"RESTORE_LOADER_USERS",
+	"RESTORE_LOADER_PROCESSES",
+	"RESTORE_WRITE_TRANSACTION_AGE",
+	"ERROR_COUNT_TO_BREAK_DATABASE",
+	"ERROR_COUNT_TO_BREAK_STORAGE",
+	"ERROR_COUNT_TO_BREAK_EVENTBUS",
+	"ERROR_WINDOW_MAX_ERRORS",
+	"ERROR_WINDOW_DURATION",
+	"ERROR_WINDOW_ITERATIONS",
+	"SUPERVISOR_MAX_RECOVERIES",
+	"TERMINATION_LOG",
+	"STATUS_LISTEN",
+	"AUDIT_LOG",
+	"AUDIT_LOG_MAX_SIZE",
+	"AUDIT_LOG_BACKUP_COUNT",
+	"ADMIN_TOKEN",
+	"ADMIN_TOKEN_FILE",
+	"LEADER_ELECTION_LEASE_FILE",
+	"LEADER_ELECTION_LEASE_DURATION",
+	"LEADER_ELECTION_IDENTITY",
+}
+
+type configReader struct {
+	fileValues map[string]string
+	strict     bool
+	problems   []error
+	warnings   []string
 }
 
 func loadConfig(envFilename string) (Config, error) {
-	if envFilename != "" {
-		err := godotenv.Load(envFilename)
+	reader, err := newConfigReader(envFilename)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if strictValue := reader.string("CONFIG_STRICT"); strictValue != "" {
+		strict, err := strconv.ParseBool(strictValue)
 		if err != nil {
-			return Config{}, errors.New(fmt.Sprintf("Error loading %s file: %s", envFilename, err))
+			return Config{}, errors.New(fmt.Sprintf("invalid CONFIG_STRICT value %q: %s", strictValue, err))
 		}
+		reader.strict = strict
 	}
 
-	pauseAfterSuccess, err := strconv.ParseInt(os.Getenv("PAUSE_AFTER_SUCCESS"), 10, 0)
-	if pauseAfterSuccess == 0 || err != nil {
-		pauseAfterSuccess = 600
+	// unknown config file keys are ignored in non-strict mode
+	if !reader.strict {
+		reader.problems = nil
 	}
 
-	pauseAfterError, err := strconv.ParseInt(os.Getenv("PAUSE_AFTER_ERROR"), 10, 0)
-	if pauseAfterError == 0 || err != nil {
-		pauseAfterError = 60
-	}
+	config := Config{
+		dekanatDbDriverName:         reader.string("DEKANAT_DB_DRIVER_NAME"),
+		kafkaHost:                   reader.string("KAFKA_HOST"),
+		kafkaSaslUsername:           reader.string("KAFKA_SASL_USERNAME"),
+		secondaryDekanatDbEventName: reader.string("SECONDARY_DEKANAT_DB_EVENT_NAME"),
 
-	errorCountToBreak, err := strconv.Atoi(os.Getenv("ERROR_COUNT_TO_BREAK"))
-	if errorCountToBreak == 0 || err != nil {
-		errorCountToBreak = 3
-	}
+		secondaryDekanatDbMaxOpenConns:    reader.int("SECONDARY_DEKANAT_DB_MAX_OPEN_CONNS", 2),
+		secondaryDekanatDbConnMaxLifetime: reader.seconds("SECONDARY_DEKANAT_DB_CONN_MAX_LIFETIME", 3600),
+		secondaryDekanatDbConnMaxIdleTime: reader.seconds("SECONDARY_DEKANAT_DB_CONN_MAX_IDLE_TIME", 300),
 
-	config := Config{
-		dekanatDbDriverName:   os.Getenv("DEKANAT_DB_DRIVER_NAME"),
-		secondaryDekanatDbDSN: os.Getenv("SECONDARY_DEKANAT_DB_DSN"),
-		kafkaHost:             os.Getenv("KAFKA_HOST"),
-		storageFile:           os.Getenv("STORAGE_FILE"),
-		pauseAfterSuccess:     time.Second * time.Duration(pauseAfterSuccess),
-		pauseAfterError:       time.Second * time.Duration(pauseAfterError),
-		errorCountToBreak:     errorCountToBreak,
+		secondaryDekanatDbFile:             reader.string("SECONDARY_DEKANAT_DB_FILE"),
+		secondaryDekanatDbFileSettleTime:   reader.seconds("SECONDARY_DEKANAT_DB_FILE_SETTLE_TIME", 60),
+		secondaryDekanatDbFilePollInterval: reader.seconds("SECONDARY_DEKANAT_DB_FILE_POLL_INTERVAL", 10),
+
+		readOnlyCheck:           reader.string("READ_ONLY_CHECK"),
+		replicationLagThreshold: reader.seconds("REPLICATION_LAG_THRESHOLD", 0),
+
+		storageFile:        reader.string("STORAGE_FILE"),
+		storageBackupCount: reader.int("STORAGE_BACKUP_COUNT", 3),
+		pauseAfterSuccess:  reader.seconds("PAUSE_AFTER_SUCCESS", 600),
+		pauseAfterError:    reader.seconds("PAUSE_AFTER_ERROR", 60),
+		errorCountToBreak:  reader.int("ERROR_COUNT_TO_BREAK", 3),
+		iterationTimeout:   reader.seconds("ITERATION_TIMEOUT", 300),
+
+		stabilityChecks:      reader.int("STABILITY_CHECKS", 0),
+		stabilityQuietPeriod: reader.seconds("STABILITY_QUIET_PERIOD", 0),
+
+		restoreLoaderUsers:         reader.list("RESTORE_LOADER_USERS"),
+		restoreLoaderProcesses:     reader.list("RESTORE_LOADER_PROCESSES"),
+		restoreWriteTransactionAge: reader.seconds("RESTORE_WRITE_TRANSACTION_AGE", 0),
+
+		errorCountToBreakByCategory: map[string]int{
+			ErrorCategoryDatabase: reader.int("ERROR_COUNT_TO_BREAK_DATABASE", 0),
+			ErrorCategoryStorage:  reader.int("ERROR_COUNT_TO_BREAK_STORAGE", 0),
+			ErrorCategoryEventbus: reader.int("ERROR_COUNT_TO_BREAK_EVENTBUS", 0),
+		},
+		errorWindowMaxErrors:  reader.int("ERROR_WINDOW_MAX_ERRORS", 0),
+		errorWindowDuration:   reader.seconds("ERROR_WINDOW_DURATION", 0),
+		errorWindowIterations: reader.int("ERROR_WINDOW_ITERATIONS", 0),
+
+		supervisorMaxRecoveries: reader.int("SUPERVISOR_MAX_RECOVERIES", 0),
+
+		terminationLog:              reader.string("TERMINATION_LOG"),
+		statusListen:                reader.string("STATUS_LISTEN"),
+		auditLog:                    reader.string("AUDIT_LOG"),
+		auditLogMaxSize:             reader.int("AUDIT_LOG_MAX_SIZE", 10),
+		auditLogBackupCount:         reader.int("AUDIT_LOG_BACKUP_COUNT", 10),
+		leaderElectionLeaseFile:     reader.string("LEADER_ELECTION_LEASE_FILE"),
+		leaderElectionLeaseDuration: reader.seconds("LEADER_ELECTION_LEASE_DURATION", 300),
+		leaderElectionIdentity:      reader.string("LEADER_ELECTION_IDENTITY"),
 	}
 
+	config.secondaryDekanatDbDSN, config.secondaryDekanatDbDSNFile = reader.secret("SECONDARY_DEKANAT_DB_DSN")
+	config.primaryDekanatDbDSN, config.primaryDekanatDbDSNFile = reader.secret("PRIMARY_DEKANAT_DB_DSN")
+	config.kafkaSaslPassword, config.kafkaSaslPasswordFile = reader.secret("KAFKA_SASL_PASSWORD")
+	config.adminToken, config.adminTokenFile = reader.secret("ADMIN_TOKEN")
+
 	if config.dekanatDbDriverName == "" {
 		config.dekanatDbDriverName = "firebirdsql"
 	}
 
 	if config.secondaryDekanatDbDSN == "" {
-		return Config{}, errors.New("empty SECONDARY_DEKANAT_DB_DSN")
+		reader.problems = append(reader.problems, errors.New("empty SECONDARY_DEKANAT_DB_DSN"))
+	}
+
+	if config.secondaryDekanatDbEventName != "" && config.dekanatDbDriverName != "firebirdsql" {
+		reader.problems = append(reader.problems, errors.New("SECONDARY_DEKANAT_DB_EVENT_NAME requires firebirdsql DB driver"))
+	}
+
+	switch config.readOnlyCheck {
+	case "":
+		config.readOnlyCheck = ReadOnlyCheckRefuse
+	case ReadOnlyCheckRefuse, ReadOnlyCheckWarn, ReadOnlyCheckOff:
+	default:
+		reader.problems = append(reader.problems, errors.New(fmt.Sprintf(
+			"invalid READ_ONLY_CHECK value %q: expected %s, %s or %s",
+			config.readOnlyCheck, ReadOnlyCheckRefuse, ReadOnlyCheckWarn, ReadOnlyCheckOff,
+		)))
+	}
+
+	if config.replicationLagThreshold > 0 && config.primaryDekanatDbDSN == "" {
+		reader.problems = append(reader.problems, errors.New("REPLICATION_LAG_THRESHOLD requires PRIMARY_DEKANAT_DB_DSN"))
+	}
+
+	if config.adminToken != "" && config.statusListen == "" {
+		reader.problems = append(reader.problems, errors.New("ADMIN_TOKEN requires STATUS_LISTEN"))
 	}
 
 	if config.kafkaHost == "" {
-		return Config{}, errors.New("empty KAFKA_HOST")
+		reader.problems = append(reader.problems, errors.New("empty KAFKA_HOST"))
+	}
+
+	if config.errorWindowMaxErrors > 0 && config.errorWindowDuration == 0 && config.errorWindowIterations == 0 {
+		reader.problems = append(reader.problems, errors.New("ERROR_WINDOW_MAX_ERRORS requires ERROR_WINDOW_DURATION or ERROR_WINDOW_ITERATIONS"))
 	}
 
 	if config.storageFile == "" {
 		config.storageFile = "storage.json"
 	}
 
+	if config.leaderElectionLeaseFile != "" && !fileLockSupported {
+		reader.problems = append(reader.problems, errors.New("LEADER_ELECTION_LEASE_FILE requires file locks, which are not supported on this platform"))
+	}
+
+	// lease is renewed during iteration, but it expires when renewal fails, e.g. shared storage is unavailable
+	if config.leaderElectionLeaseFile != "" && config.leaderElectionLeaseDuration < config.iterationTimeout {
+		reader.problems = append(reader.problems, errors.New(fmt.Sprintf(
+			"LEADER_ELECTION_LEASE_DURATION (%d) should not be shorter than ITERATION_TIMEOUT (%d)",
+			int(config.leaderElectionLeaseDuration.Seconds()), int(config.iterationTimeout.Seconds()),
+		)))
+	}
+
+	if config.leaderElectionLeaseFile != "" && config.leaderElectionIdentity == "" {
+		hostname, _ := os.Hostname()
+		config.leaderElectionIdentity = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	if len(reader.problems) != 0 {
+		return Config{}, errors.Join(reader.problems...)
+	}
+
+	config.warnings = reader.warnings
 	return config, nil
 }
+
+func (config Config) getErrorCountToBreak(category string) int {
+	if config.errorCountToBreakByCategory[category] > 0 {
+		return config.errorCountToBreakByCategory[category]
+	}
+
+	return config.errorCountToBreak
+}
+
+// loadFile reads YAML config file with the same options as env vars (e.g. `kafka_host: kafka:9092`)
+func (reader *configReader) loadFile(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error loading %s file: %s", filename, err))
+	}
+
+	var rawValues map[string]interface{}
+	err = yaml.Unmarshal(content, &rawValues)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error parsing %s file: %s", filename, err))
+	}
+
+	reader.fileValues = make(map[string]string, len(rawValues))
+	for key, value := range rawValues {
+		name := strings.ToUpper(key)
+		if !isKnownConfigKey(name) {
+			reader.problems = append(reader.problems, errors.New(fmt.Sprintf("unknown key %s in %s", key, filename)))
+			continue
+		}
+
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			reader.problems = append(reader.problems, errors.New(fmt.Sprintf("%s: expected scalar value in %s", key, filename)))
+		case nil:
+			reader.fileValues[name] = ""
+		default:
+			reader.fileValues[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// newConfigReader loads .env file to environment and optional CONFIG_FILE, values are not validated yet
+func newConfigReader(envFilename string) (*configReader, error) {
+	if envFilename != "" {
+		err := godotenv.Load(envFilename)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error loading %s file: %s", envFilename, err))
+		}
+	}
+
+	reader := &configReader{}
+	if configFilename := os.Getenv("CONFIG_FILE"); configFilename != "" {
+		err := reader.loadFile(configFilename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reader, nil
+}
+
+// string returns env var value, or config file value when env var is empty
+func (reader *configReader) string(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return reader.fileValues[name]
+}
+
+// secret returns value of option or content of file from option with "_FILE" suffix
+func (reader *configReader) secret(name string) (value string, filename string) {
+	value = reader.string(name)
+	filename = reader.string(name + "_FILE")
+	if filename == "" {
+		return value, ""
+	}
+
+	if value != "" {
+		reader.problems = append(reader.problems, errors.New(fmt.Sprintf("both %s and %s_FILE are set", name, name)))
+		return "", ""
+	}
+
+	value, err := readSecret("", filename)
+	if err != nil {
+		reader.problems = append(reader.problems, errors.New(name+"_FILE: "+err.Error()))
+		return "", ""
+	}
+
+	return value, filename
+}
+
+// list - comma separated values, empty items are skipped
+func (reader *configReader) list(name string) []string {
+	var values []string
+	for _, value := range strings.Split(reader.string(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (reader *configReader) int(name string, defaultValue int) int {
+	value := reader.string(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err == nil && parsed <= 0 {
+		err = errors.New("should be greater than zero")
+	}
+
+	if err != nil {
+		reader.invalid(name, value, err, strconv.Itoa(defaultValue))
+		return defaultValue
+	}
+
+	return parsed
+}
+
+func (reader *configReader) seconds(name string, defaultValue int) time.Duration {
+	return time.Second * time.Duration(reader.int(name, defaultValue))
+}
+
+// invalid is a problem in strict mode, otherwise default value is used with warning
+func (reader *configReader) invalid(name string, value string, err error, defaultValue string) {
+	if reader.strict {
+		reader.problems = append(reader.problems, errors.New(fmt.Sprintf("invalid %s value %q: %s", name, value, err)))
+		return
+	}
+
+	reader.warnings = append(reader.warnings, fmt.Sprintf("invalid %s value %q: %s, default %s is used", name, value, err, defaultValue))
+}
+
+func isKnownConfigKey(name string) bool {
+	for _, key := range configKeys {
+		if key == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -13,10 +13,31 @@ var expectedConfig = Config{
 	kafkaHost:             "KAFKA:9999",
 	dekanatDbDriverName:   "firebird-test",
 	secondaryDekanatDbDSN: "USER:PASSOWORD@HOST/DATABASE",
-	storageFile:           "test-storage.txt",
-	pauseAfterSuccess:     time.Hour * 6,
-	pauseAfterError:       time.Hour,
-	errorCountToBreak:     3,
+
+	secondaryDekanatDbMaxOpenConns:     2,
+	secondaryDekanatDbConnMaxLifetime:  time.Hour,
+	secondaryDekanatDbConnMaxIdleTime:  time.Minute * 5,
+	secondaryDekanatDbFileSettleTime:   time.Minute,
+	secondaryDekanatDbFilePollInterval: time.Second * 10,
+	readOnlyCheck:                      ReadOnlyCheckRefuse,
+
+	storageFile:        "test-storage.txt",
+	storageBackupCount: 3,
+	pauseAfterSuccess:  time.Hour * 6,
+	pauseAfterError:    time.Hour,
+	errorCountToBreak:  3,
+	iterationTimeout:   time.Minute * 5,
+
+	errorCountToBreakByCategory: map[string]int{
+		ErrorCategoryDatabase: 0,
+		ErrorCategoryStorage:  0,
+		ErrorCategoryEventbus: 0,
+	},
+
+	leaderElectionLeaseDuration: time.Minute * 5,
+
+	auditLogMaxSize:     10,
+	auditLogBackupCount: 10,
 }
 
 func TestLoadConfigFromEnvVars(t *testing.T) {
@@ -130,6 +151,241 @@ func TestLoadConfigFromEnvVars(t *testing.T) {
 	})
 }
 
+func TestLoadConfigFromConfigFile(t *testing.T) {
+	var configFileContent string
+
+	configFileContent += fmt.Sprintf("kafka_host: %s\n", expectedConfig.kafkaHost)
+	configFileContent += fmt.Sprintf("dekanat_db_driver_name: %s\n", expectedConfig.dekanatDbDriverName)
+	configFileContent += fmt.Sprintf("secondary_dekanat_db_dsn: %s\n", expectedConfig.secondaryDekanatDbDSN)
+	configFileContent += fmt.Sprintf("storage_file: %s\n", expectedConfig.storageFile)
+	configFileContent += fmt.Sprintf("pause_after_success: %d\n", int(expectedConfig.pauseAfterSuccess.Seconds()))
+	configFileContent += fmt.Sprintf("pause_after_error: %d\n", int(expectedConfig.pauseAfterError.Seconds()))
+	configFileContent += fmt.Sprintf("error_count_to_break: %d\n", expectedConfig.errorCountToBreak)
+
+	testConfigFilename := "TestLoadConfigFromConfigFile.yaml"
+	err := os.WriteFile(testConfigFilename, []byte(configFileContent), 0644)
+	defer os.Remove(testConfigFilename)
+	assert.NoErrorf(t, err, "got unexpected while write file %s error %s", testConfigFilename, err)
+
+	resetEnv := func() {
+		for _, key := range configKeys {
+			_ = os.Setenv(key, "")
+		}
+		_ = os.Setenv("CONFIG_FILE", testConfigFilename)
+	}
+	defer os.Unsetenv("CONFIG_FILE")
+	defer os.Unsetenv("CONFIG_STRICT")
+
+	t.Run("FromConfigFile", func(t *testing.T) {
+		resetEnv()
+
+		config, err := loadConfig("")
+
+		assert.NoErrorf(t, err, "got unexpected error %s", err)
+		assertConfig(t, expectedConfig, config)
+		assert.Equalf(t, expectedConfig, config, "Expected for %v, actual: %v", expectedConfig, config)
+	})
+
+	t.Run("EnvOverridesConfigFile", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("KAFKA_HOST", "override:9092")
+		_ = os.Setenv("PAUSE_AFTER_ERROR", "5")
+
+		config, err := loadConfig("")
+
+		assert.NoErrorf(t, err, "got unexpected error %s", err)
+		assert.Equal(t, "override:9092", config.kafkaHost)
+		assert.Equal(t, time.Second*5, config.pauseAfterError)
+		assert.Equal(t, expectedConfig.secondaryDekanatDbDSN, config.secondaryDekanatDbDSN)
+	})
+
+	t.Run("InvalidValuesFallbackToDefaults", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("PAUSE_AFTER_ERROR", "6o")
+		_ = os.Setenv("ERROR_COUNT_TO_BREAK", "-1")
+
+		config, err := loadConfig("")
+
+		assert.NoErrorf(t, err, "got unexpected error %s", err)
+		assert.Equal(t, time.Minute, config.pauseAfterError, "Wrong default pauseAfterError")
+		assert.Equal(t, 3, config.errorCountToBreak, "Wrong default errorCountToBreak")
+		assert.Equal(t, []string{
+			`invalid PAUSE_AFTER_ERROR value "6o": strconv.Atoi: parsing "6o": invalid syntax, default 60 is used`,
+			`invalid ERROR_COUNT_TO_BREAK value "-1": should be greater than zero, default 3 is used`,
+		}, config.warnings)
+	})
+
+	t.Run("StrictModeReportsAllProblems", func(t *testing.T) {
+		unknownKeyFilename := "TestLoadConfigStrict.yaml"
+		err := os.WriteFile(unknownKeyFilename, []byte(configFileContent+"pause_after_eror: 10\n"), 0644)
+		defer os.Remove(unknownKeyFilename)
+		assert.NoError(t, err)
+
+		resetEnv()
+		_ = os.Setenv("CONFIG_FILE", unknownKeyFilename)
+		_ = os.Setenv("CONFIG_STRICT", "true")
+		_ = os.Setenv("PAUSE_AFTER_ERROR", "6o")
+		_ = os.Setenv("ERROR_COUNT_TO_BREAK", "0")
+
+		config, err := loadConfig("")
+
+		assert.Error(t, err, "loadConfig() should exit with error, actual error is nil")
+		assert.Empty(t, config.kafkaHost)
+		assert.Contains(t, err.Error(), "unknown key pause_after_eror")
+		assert.Contains(t, err.Error(), "invalid PAUSE_AFTER_ERROR value \"6o\"")
+		assert.Contains(t, err.Error(), "invalid ERROR_COUNT_TO_BREAK value \"0\"")
+	})
+
+	t.Run("ErrorWindowWithoutSize", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("ERROR_WINDOW_MAX_ERRORS", "5")
+		defer os.Unsetenv("ERROR_WINDOW_MAX_ERRORS")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "ERROR_WINDOW_MAX_ERRORS requires ERROR_WINDOW_DURATION or ERROR_WINDOW_ITERATIONS", err.Error())
+	})
+
+	t.Run("DbEventWithoutFirebirdDriver", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_EVENT_NAME", "dekanat_restored")
+		defer os.Unsetenv("SECONDARY_DEKANAT_DB_EVENT_NAME")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "SECONDARY_DEKANAT_DB_EVENT_NAME requires firebirdsql DB driver", err.Error())
+	})
+
+	t.Run("InvalidReadOnlyCheck", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("READ_ONLY_CHECK", "maybe")
+		defer os.Unsetenv("READ_ONLY_CHECK")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, `invalid READ_ONLY_CHECK value "maybe": expected refuse, warn or off`, err.Error())
+	})
+
+	t.Run("AdminTokenWithoutStatusListen", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("ADMIN_TOKEN", "admin-secret")
+		defer os.Unsetenv("ADMIN_TOKEN")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "ADMIN_TOKEN requires STATUS_LISTEN", err.Error())
+	})
+
+	t.Run("LeaderElectionLeaseShorterThanIterationTimeout", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("LEADER_ELECTION_LEASE_FILE", "lease.json")
+		_ = os.Setenv("LEADER_ELECTION_LEASE_DURATION", "60")
+		defer os.Unsetenv("LEADER_ELECTION_LEASE_FILE")
+		defer os.Unsetenv("LEADER_ELECTION_LEASE_DURATION")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "LEADER_ELECTION_LEASE_DURATION (60) should not be shorter than ITERATION_TIMEOUT (300)", err.Error())
+	})
+
+	t.Run("ReplicationLagThresholdWithoutPrimaryDb", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("REPLICATION_LAG_THRESHOLD", "86400")
+		defer os.Unsetenv("REPLICATION_LAG_THRESHOLD")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "REPLICATION_LAG_THRESHOLD requires PRIMARY_DEKANAT_DB_DSN", err.Error())
+	})
+
+	t.Run("ListValues", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("RESTORE_LOADER_USERS", " LOADER, ,SYSDBA ")
+		defer os.Unsetenv("RESTORE_LOADER_USERS")
+
+		config, err := loadConfig("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"LOADER", "SYSDBA"}, config.restoreLoaderUsers)
+		assert.Nil(t, config.restoreLoaderProcesses)
+	})
+
+	t.Run("InvalidStrictValue", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("CONFIG_STRICT", "maybe")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid CONFIG_STRICT value")
+	})
+
+	t.Run("NotExistConfigFile", func(t *testing.T) {
+		resetEnv()
+		_ = os.Setenv("CONFIG_FILE", "not-exists.yaml")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Equal(t, "Error loading not-exists.yaml file: open not-exists.yaml: no such file or directory", err.Error())
+	})
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	dsnFilename := os.TempDir() + "/secondary-db-watcher-config-dsn"
+	passwordFilename := os.TempDir() + "/secondary-db-watcher-config-kafka-password"
+	_ = os.WriteFile(dsnFilename, []byte(expectedConfig.secondaryDekanatDbDSN+"\n"), 0600)
+	_ = os.WriteFile(passwordFilename, []byte("kafka-password\n"), 0600)
+
+	defer func() {
+		_ = os.Remove(dsnFilename)
+		_ = os.Remove(passwordFilename)
+		_ = os.Unsetenv("SECONDARY_DEKANAT_DB_DSN_FILE")
+		_ = os.Unsetenv("KAFKA_SASL_PASSWORD_FILE")
+	}()
+
+	t.Run("FromSecretFiles", func(t *testing.T) {
+		_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN_FILE", dsnFilename)
+		_ = os.Setenv("KAFKA_SASL_PASSWORD_FILE", passwordFilename)
+
+		config, err := loadConfig("")
+
+		assert.NoErrorf(t, err, "got unexpected error %s", err)
+		assert.Equal(t, expectedConfig.secondaryDekanatDbDSN, config.secondaryDekanatDbDSN)
+		assert.Equal(t, dsnFilename, config.secondaryDekanatDbDSNFile)
+		assert.Equal(t, "kafka-password", config.kafkaSaslPassword)
+		assert.Equal(t, passwordFilename, config.kafkaSaslPasswordFile)
+	})
+
+	t.Run("BothValueAndFile", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN_FILE", dsnFilename)
+		defer os.Setenv("SECONDARY_DEKANAT_DB_DSN", "")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "both SECONDARY_DEKANAT_DB_DSN and SECONDARY_DEKANAT_DB_DSN_FILE are set")
+	})
+
+	t.Run("NotExistSecretFile", func(t *testing.T) {
+		_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN_FILE", "not-exists-dsn")
+
+		_, err := loadConfig("")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "SECONDARY_DEKANAT_DB_DSN_FILE: failed to read secret file not-exists-dsn")
+	})
+}
+
 func assertConfig(t *testing.T, expected Config, actual Config) {
 	assert.Equalf(
 		t, expected.kafkaHost, actual.kafkaHost,
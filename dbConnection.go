@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// reconnectConn marks connection as bad on "connection lost" errors: database/sql discards it
+// and retries the query with another (new) connection within the same iteration.
+// Retry is safe because the watcher only reads from secondary DB.
+// Optional driver interfaces are delegated to the inner connection, rows are wrapped to detect loss during fetch.
+type reconnectConn struct {
+	conn driver.Conn
+	lost bool
+}
+
+func (conn *reconnectConn) check(err error) error {
+	if err == nil || err == driver.ErrSkip || !isConnectionLostError(err) {
+		return err
+	}
+
+	conn.lost = true
+	return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+}
+
+func (conn *reconnectConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := conn.conn.Prepare(query)
+	return stmt, conn.check(err)
+}
+
+func (conn *reconnectConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := conn.conn.(driver.ConnPrepareContext)
+	if !ok {
+		return conn.Prepare(query)
+	}
+
+	stmt, err := preparer.PrepareContext(ctx, query)
+	return stmt, conn.check(err)
+}
+
+func (conn *reconnectConn) Close() error {
+	return conn.conn.Close()
+}
+
+// Begin is required by driver.Conn, transactions are not used by the watcher
+func (conn *reconnectConn) Begin() (driver.Tx, error) {
+	//lint:ignore SA1019 required by driver.Conn interface
+	tx, err := conn.conn.Begin()
+	return tx, conn.check(err)
+}
+
+func (conn *reconnectConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := conn.conn.(driver.ConnBeginTx)
+	if ok {
+		tx, err := beginner.BeginTx(ctx, opts)
+		return tx, conn.check(err)
+	}
+
+	if opts.ReadOnly || opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("driver does not support transaction options")
+	}
+
+	return conn.Begin()
+}
+
+// CheckNamedValue - driver.ErrSkip falls back to the default conversion of arguments
+func (conn *reconnectConn) CheckNamedValue(value *driver.NamedValue) error {
+	checker, ok := conn.conn.(driver.NamedValueChecker)
+	if !ok {
+		return driver.ErrSkip
+	}
+
+	return checker.CheckNamedValue(value)
+}
+
+func (conn *reconnectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := conn.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, conn.check(err)
+	}
+
+	return &reconnectRows{Rows: rows, conn: conn}, nil
+}
+
+func (conn *reconnectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := conn.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	result, err := execer.ExecContext(ctx, query, args)
+	return result, conn.check(err)
+}
+
+func (conn *reconnectConn) Ping(ctx context.Context) error {
+	pinger, ok := conn.conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+
+	return conn.check(pinger.Ping(ctx))
+}
+
+// IsValid - lost connection is not returned to the pool
+func (conn *reconnectConn) IsValid() bool {
+	return !conn.lost
+}
+
+// reconnectRows marks connection as bad when it is lost while rows are fetched,
+// query is not retried because part of rows could be already scanned
+type reconnectRows struct {
+	driver.Rows
+	conn *reconnectConn
+}
+
+func (rows *reconnectRows) Next(dest []driver.Value) error {
+	err := rows.Rows.Next(dest)
+	// io.EOF is the end of rows, not the connection loss
+	if err == io.EOF {
+		return err
+	}
+
+	return rows.conn.check(err)
+}
+
+func (rows *reconnectRows) Close() error {
+	return rows.conn.check(rows.Rows.Close())
+}
+
+func (rows *reconnectRows) ColumnTypeScanType(index int) reflect.Type {
+	scanType, ok := rows.Rows.(driver.RowsColumnTypeScanType)
+	if !ok {
+		return reflect.TypeOf(new(interface{})).Elem()
+	}
+
+	return scanType.ColumnTypeScanType(index)
+}
+
+func (rows *reconnectRows) ColumnTypeDatabaseTypeName(index int) string {
+	typeName, ok := rows.Rows.(driver.RowsColumnTypeDatabaseTypeName)
+	if !ok {
+		return ""
+	}
+
+	return typeName.ColumnTypeDatabaseTypeName(index)
+}
+
+func (rows *reconnectRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	typeLength, ok := rows.Rows.(driver.RowsColumnTypeLength)
+	if !ok {
+		return 0, false
+	}
+
+	return typeLength.ColumnTypeLength(index)
+}
+
+func (rows *reconnectRows) ColumnTypeNullable(index int) (nullable bool, ok bool) {
+	typeNullable, ok := rows.Rows.(driver.RowsColumnTypeNullable)
+	if !ok {
+		return false, false
+	}
+
+	return typeNullable.ColumnTypeNullable(index)
+}
+
+func (rows *reconnectRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	precisionScale, ok := rows.Rows.(driver.RowsColumnTypePrecisionScale)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return precisionScale.ColumnTypePrecisionScale(index)
+}
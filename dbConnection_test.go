@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// connectionLostDriver - the first opened connection is lost on the first query, next connections work
+type connectionLostDriver struct {
+	opened int
+}
+
+func (lostDriver *connectionLostDriver) Open(dsn string) (driver.Conn, error) {
+	lostDriver.opened++
+	return &connectionLostConn{lost: lostDriver.opened == 1}, nil
+}
+
+type connectionLostConn struct {
+	lost bool
+}
+
+func (conn *connectionLostConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (conn *connectionLostConn) Close() error {
+	return nil
+}
+
+func (conn *connectionLostConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (conn *connectionLostConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if conn.lost {
+		return nil, errors.New("Error reading data from the connection: " + io.EOF.Error())
+	}
+
+	return &singleValueRows{value: int64(1)}, nil
+}
+
+type singleValueRows struct {
+	value driver.Value
+	read  bool
+}
+
+func (rows *singleValueRows) Columns() []string {
+	return []string{"VALUE"}
+}
+
+func (rows *singleValueRows) Close() error {
+	return nil
+}
+
+func (rows *singleValueRows) Next(dest []driver.Value) error {
+	if rows.read {
+		return io.EOF
+	}
+
+	rows.read = true
+	dest[0] = rows.value
+	return nil
+}
+
+// lostDuringFetchRows - connection is lost after the first row
+type lostDuringFetchRows struct {
+	singleValueRows
+}
+
+func (rows *lostDuringFetchRows) Next(dest []driver.Value) error {
+	if rows.read {
+		return errors.New("connection shutdown")
+	}
+
+	return rows.singleValueRows.Next(dest)
+}
+
+var testConnectionLostDriver = &connectionLostDriver{}
+
+func init() {
+	sql.Register("connection-lost", testConnectionLostDriver)
+}
+
+func TestReconnectConn(t *testing.T) {
+	t.Run("Lost connection is discarded and query is retried", func(t *testing.T) {
+		// driver is registered once per process, e.g. for go test -count=2
+		testConnectionLostDriver.opened = 0
+		config := Config{
+			dekanatDbDriverName:            "connection-lost",
+			secondaryDekanatDbDSN:          "USER:PASSWORD@HOST/DATABASE",
+			secondaryDekanatDbMaxOpenConns: 1,
+		}
+
+		db, err := openSecondaryDekanatDb(config)
+		assert.NoError(t, err)
+		defer db.Close()
+
+		var value int64
+		err = db.QueryRow("SELECT 1 FROM RDB$DATABASE").Scan(&value)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), value)
+		assert.Equal(t, 2, testConnectionLostDriver.opened)
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		conn := &reconnectConn{conn: &connectionLostConn{}}
+		expectedError := errors.New("Dynamic SQL Error")
+
+		assert.Equal(t, expectedError, conn.check(expectedError))
+		assert.True(t, conn.IsValid())
+	})
+
+	t.Run("Connection lost error", func(t *testing.T) {
+		conn := &reconnectConn{conn: &connectionLostConn{}}
+		err := conn.check(io.ErrUnexpectedEOF)
+
+		assert.ErrorIs(t, err, driver.ErrBadConn)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.False(t, conn.IsValid())
+	})
+
+	t.Run("Connection lost during fetch", func(t *testing.T) {
+		conn := &reconnectConn{conn: &connectionLostConn{}}
+		rows := &reconnectRows{Rows: &lostDuringFetchRows{singleValueRows{value: int64(1)}}, conn: conn}
+		dest := make([]driver.Value, 1)
+
+		assert.NoError(t, rows.Next(dest))
+		err := rows.Next(dest)
+
+		assert.ErrorIs(t, err, driver.ErrBadConn)
+		assert.True(t, isConnectionLostError(err))
+		assert.False(t, conn.IsValid())
+	})
+
+	t.Run("End of rows is not connection loss", func(t *testing.T) {
+		conn := &reconnectConn{conn: &connectionLostConn{}}
+		rows, err := conn.QueryContext(context.Background(), "SELECT 1 FROM RDB$DATABASE", nil)
+		assert.NoError(t, err)
+		dest := make([]driver.Value, 1)
+
+		assert.NoError(t, rows.Next(dest))
+		assert.Equal(t, io.EOF, rows.Next(dest))
+		assert.True(t, conn.IsValid())
+		assert.Equal(t, reflect.TypeOf(new(interface{})).Elem(), rows.(driver.RowsColumnTypeScanType).ColumnTypeScanType(0))
+	})
+
+	t.Run("Optional driver interfaces are delegated", func(t *testing.T) {
+		conn := &reconnectConn{conn: &connectionLostConn{}}
+
+		assert.Implements(t, (*driver.ConnBeginTx)(nil), conn)
+		assert.Implements(t, (*driver.NamedValueChecker)(nil), conn)
+		assert.Implements(t, (*driver.QueryerContext)(nil), conn)
+		assert.Implements(t, (*driver.ExecerContext)(nil), conn)
+
+		assert.Equal(t, driver.ErrSkip, conn.CheckNamedValue(&driver.NamedValue{Value: 1}))
+		_, err := conn.BeginTx(context.Background(), driver.TxOptions{})
+		assert.EqualError(t, err, "transactions are not supported")
+		_, err = conn.BeginTx(context.Background(), driver.TxOptions{ReadOnly: true})
+		assert.EqualError(t, err, "driver does not support transaction options")
+	})
+}
+
+func TestOpenSecondaryDekanatDbPool(t *testing.T) {
+	db, err := openSecondaryDekanatDb(Config{
+		dekanatDbDriverName:               "connection-lost",
+		secondaryDekanatDbMaxOpenConns:    3,
+		secondaryDekanatDbConnMaxLifetime: time.Hour,
+		secondaryDekanatDbConnMaxIdleTime: time.Minute,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, db.Stats().MaxOpenConnections)
+	_ = db.Close()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nakagami/firebirdsql"
+	"io"
+	"time"
+)
+
+// subscriptionCheckInterval - subscription could be closed without error notification, e.g. on clean disconnect
+const subscriptionCheckInterval = time.Second * 10
+
+var SubscriptionClosedError = errors.New("subscription closed")
+
+// DbEventListener subscribes to Firebird POST_EVENT and triggers DB check immediately when event fires.
+// Polling in the main loop stays as fallback; subscription is restored after pauseAfterError on failure.
+type DbEventListener struct {
+	out        io.Writer
+	eventName  string
+	dsn        string
+	dsnFile    string
+	retryPause time.Duration
+	trigger    *IterationTrigger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDbEventListener(out io.Writer, config Config, trigger *IterationTrigger) *DbEventListener {
+	return &DbEventListener{
+		out:        out,
+		eventName:  config.secondaryDekanatDbEventName,
+		dsn:        config.secondaryDekanatDbDSN,
+		dsnFile:    config.secondaryDekanatDbDSNFile,
+		retryPause: config.pauseAfterError,
+		trigger:    trigger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (listener *DbEventListener) start() {
+	go listener.run()
+}
+
+func (listener *DbEventListener) close() {
+	close(listener.stop)
+	<-listener.done
+}
+
+func (listener *DbEventListener) run() {
+	defer close(listener.done)
+
+	for {
+		err := listener.listen()
+		if err == nil {
+			return
+		}
+
+		fmt.Fprintln(listener.out, getCurrentDatetime()+" DB event subscription error: "+err.Error())
+		select {
+		case <-time.After(listener.retryPause):
+		case <-listener.stop:
+			return
+		}
+	}
+}
+
+// listen returns nil only when listener is stopped
+func (listener *DbEventListener) listen() error {
+	dsn, err := readSecret(listener.dsn, listener.dsnFile)
+	if err != nil {
+		return err
+	}
+
+	// DSN from secret file is hidden in errors as well
+	secrets := Config{secondaryDekanatDbDSN: dsn}
+
+	fbEvent, err := firebirdsql.NewFBEvent(dsn)
+	if err != nil {
+		return hideSecrets(err, secrets)
+	}
+	defer fbEvent.Close()
+
+	subscription, err := fbEvent.Subscribe([]string{listener.eventName}, func(event firebirdsql.Event) {
+		// the first notification after subscribe has zero count
+		if event.Count > 0 {
+			fmt.Fprintf(listener.out, "%s DB event %s fired %d times\n", getCurrentDatetime(), event.Name, event.Count)
+			listener.trigger.fire(TriggerSourceDbEvent)
+		}
+	})
+	if err != nil {
+		return hideSecrets(err, secrets)
+	}
+
+	closed := make(chan error, 1)
+	subscription.NotifyClose(closed)
+	fmt.Fprintln(listener.out, getCurrentDatetime()+" Subscribed to DB event "+listener.eventName)
+
+	err = waitSubscription(closed, subscription.IsClose, subscriptionCheckInterval, listener.stop)
+	if err != nil {
+		return hideSecrets(err, secrets)
+	}
+
+	return nil
+}
+
+// waitSubscription returns nil when listener is stopped, any close of subscription is an error to resubscribe
+func waitSubscription(closed <-chan error, isClosed func() bool, checkInterval time.Duration, stop <-chan struct{}) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-closed:
+			if err == nil {
+				return SubscriptionClosedError
+			}
+			return fmt.Errorf("%w: %w", SubscriptionClosedError, err)
+		case <-ticker.C:
+			if isClosed() {
+				return SubscriptionClosedError
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
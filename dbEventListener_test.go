@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWaitSubscription(t *testing.T) {
+	t.Run("Closed with error", func(t *testing.T) {
+		closed := make(chan error, 1)
+		closed <- errors.New("connection reset")
+
+		err := waitSubscription(closed, func() bool { return false }, time.Hour, make(chan struct{}))
+
+		assert.ErrorIs(t, err, SubscriptionClosedError)
+		assert.EqualError(t, err, "subscription closed: connection reset")
+	})
+
+	t.Run("Closed without error notification", func(t *testing.T) {
+		checks := 0
+		isClosed := func() bool {
+			checks++
+			return checks == 3
+		}
+
+		err := waitSubscription(make(chan error), isClosed, time.Millisecond, make(chan struct{}))
+
+		assert.Equal(t, SubscriptionClosedError, err)
+		assert.Equal(t, 3, checks)
+	})
+
+	t.Run("Nil error on closed channel", func(t *testing.T) {
+		closed := make(chan error)
+		close(closed)
+
+		err := waitSubscription(closed, func() bool { return false }, time.Hour, make(chan struct{}))
+
+		assert.Equal(t, SubscriptionClosedError, err)
+	})
+
+	t.Run("Stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+
+		err := waitSubscription(make(chan error), func() bool { return false }, time.Hour, stop)
+
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const GetDbIdentityQuery = "SELECT MON$CREATION_DATE, MON$ODS_MAJOR, MON$ODS_MINOR, MON$GUID FROM MON$DATABASE"
+
+// GetDbIdentityLegacyQuery - Firebird before version 4 has no MON$GUID
+const GetDbIdentityLegacyQuery = "SELECT MON$CREATION_DATE, MON$ODS_MAJOR, MON$ODS_MINOR FROM MON$DATABASE"
+
+// dbIdentity - identity of .fdb file: it is changed when ops replace the file with freshly restored one
+type dbIdentity struct {
+	CreationDate time.Time
+	Guid         string `json:",omitempty"`
+	OdsVersion   string
+}
+
+func getDbIdentity(secondaryDekanatDb *sql.DB) (identity dbIdentity, err error) {
+	var odsMajor, odsMinor int
+	var guid sql.NullString
+
+	err = secondaryDekanatDb.QueryRow(GetDbIdentityQuery).Scan(&identity.CreationDate, &odsMajor, &odsMinor, &guid)
+	if err != nil && strings.Contains(err.Error(), "Column unknown") {
+		err = secondaryDekanatDb.QueryRow(GetDbIdentityLegacyQuery).Scan(&identity.CreationDate, &odsMajor, &odsMinor)
+	}
+	if err != nil {
+		return identity, err
+	}
+
+	identity.Guid = strings.TrimSpace(guid.String)
+	identity.OdsVersion = fmt.Sprintf("%d.%d", odsMajor, odsMinor)
+	return identity, nil
+}
+
+func (identity dbIdentity) isZero() bool {
+	return identity.CreationDate.IsZero() && identity.Guid == "" && identity.OdsVersion == ""
+}
+
+// isReplacedBy - identity of states stored before identity tracking is unknown, so it is never replaced.
+// Guid is compared only when both are known: it is empty on Firebird before version 4, e.g. before in-place upgrade.
+func (identity dbIdentity) isReplacedBy(current dbIdentity) bool {
+	if identity.isZero() || current.isZero() {
+		return false
+	}
+
+	guidChanged := identity.Guid != "" && current.Guid != "" && identity.Guid != current.Guid
+
+	return guidChanged || identity.OdsVersion != current.OdsVersion || !identity.CreationDate.Equal(current.CreationDate)
+}
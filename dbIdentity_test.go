@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGetDbIdentity(t *testing.T) {
+	creationDate := time.Date(2023, 9, 1, 2, 0, 0, 0, time.Local)
+
+	t.Run("With GUID", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetDbIdentityQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$CREATION_DATE", "MON$ODS_MAJOR", "MON$ODS_MINOR", "MON$GUID"}).
+				AddRow(creationDate, 13, 0, "{6F9619FF-8B86-D011-B42D-00C04FC964FF}  "),
+		)
+
+		identity, err := getDbIdentity(db)
+
+		assert.NoError(t, err)
+		assert.Equal(t, dbIdentity{CreationDate: creationDate, Guid: "{6F9619FF-8B86-D011-B42D-00C04FC964FF}", OdsVersion: "13.0"}, identity)
+	})
+
+	t.Run("Firebird without MON$GUID", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetDbIdentityQuery)).WillReturnError(
+			errors.New("Dynamic SQL Error\nSQL error code = -206\nColumn unknown\nMON$GUID"),
+		)
+		mock.ExpectQuery(regexp.QuoteMeta(GetDbIdentityLegacyQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$CREATION_DATE", "MON$ODS_MAJOR", "MON$ODS_MINOR"}).AddRow(creationDate, 12, 0),
+		)
+
+		identity, err := getDbIdentity(db)
+
+		assert.NoError(t, err)
+		assert.Equal(t, dbIdentity{CreationDate: creationDate, OdsVersion: "12.0"}, identity)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetDbIdentityQuery)).WillReturnError(errors.New("dummy error"))
+
+		_, err := getDbIdentity(db)
+
+		assert.EqualError(t, err, "dummy error")
+	})
+}
+
+func TestDbIdentityIsReplacedBy(t *testing.T) {
+	identity := dbIdentity{CreationDate: time.Date(2023, 9, 1, 2, 0, 0, 0, time.UTC), Guid: "{A}", OdsVersion: "13.0"}
+
+	restored := identity
+	restored.CreationDate = restored.CreationDate.Add(time.Hour * 24)
+
+	upgraded := identity
+	upgraded.OdsVersion = "13.1"
+
+	firebird3 := identity
+	firebird3.Guid = ""
+
+	replacedGuid := identity
+	replacedGuid.Guid = "{B}"
+
+	assert.False(t, identity.isReplacedBy(identity))
+	assert.False(t, dbIdentity{}.isReplacedBy(identity), "unknown identity is never replaced")
+	assert.False(t, identity.isReplacedBy(dbIdentity{}))
+	assert.True(t, identity.isReplacedBy(restored))
+	assert.True(t, identity.isReplacedBy(upgraded))
+	assert.True(t, identity.isReplacedBy(replacedGuid))
+	assert.False(t, firebird3.isReplacedBy(identity), "Guid appears after in-place upgrade to Firebird 4")
+	assert.False(t, identity.isReplacedBy(firebird3))
+}
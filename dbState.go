@@ -5,8 +5,12 @@ import "time"
 type dbState struct {
 	ActualDatetime time.Time
 	EducationYear  int
+	// LastSessionId - TSESS_LOG.ID of the newest session, 0 for states stored before session tracking
+	LastSessionId int64
+	// Identity - database file identity, empty for states stored before identity tracking
+	Identity dbIdentity
 }
 
 func (a dbState) isEqual(b dbState) bool {
-	return a.EducationYear == b.EducationYear && a.ActualDatetime.Equal(b.ActualDatetime)
+	return a.EducationYear == b.EducationYear && a.ActualDatetime.Equal(b.ActualDatetime) && !a.Identity.isReplacedBy(b.Identity)
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/kneu-messenger-pigeon/fileStorage"
@@ -15,102 +14,250 @@ const FirebirdTimeFormat = "2006-01-02T15:04:05"
 
 const StorageTimeFormat = time.RFC3339
 
-const GetLastDatetimeQuery = "SELECT FIRST 1 CON_DATA FROM TSESS_LOG ORDER BY ID DESC"
+const GetLastSessionQuery = "SELECT FIRST 1 ID, CON_DATA FROM TSESS_LOG ORDER BY ID DESC"
+
+const GetNewSessionsQuery = "SELECT ID, CON_DATA FROM TSESS_LOG WHERE ID > ? AND ID <= ? ORDER BY ID ASC"
 
 const GetFirstLessonRegDateQuery = "SELECT FIRST 1 REGDATE FROM T_PRJURN ORDER BY REGDATE ASC"
 
 func makeDbState(secondaryDekanatDb *sql.DB) (state dbState, err error) {
-	state.ActualDatetime, err = getDbStateDatetime(secondaryDekanatDb)
+	state.LastSessionId, state.ActualDatetime, err = getLastSession(secondaryDekanatDb)
 	if err != nil {
-		return state, errors.New("Failed to get last datetime from DB: " + err.Error())
+		return state, classifyError(dbErrorClass(err), fmt.Errorf("Failed to get last datetime from DB: %w", err))
 	}
 
 	state.EducationYear, err = getCurrentYear(secondaryDekanatDb)
 	if err != nil {
-		return state, errors.New("failed to detect current education year: " + err.Error())
+		return state, classifyError(dbErrorClass(err), fmt.Errorf("failed to detect current education year: %w", err))
+	}
+
+	state.Identity, err = getDbIdentity(secondaryDekanatDb)
+	if err != nil {
+		return state, classifyError(dbErrorClass(err), fmt.Errorf("failed to get DB identity: %w", err))
 	}
 
 	return state, nil
 }
 
-func checkDekanatDb(secondaryDekanatDb *sql.DB, storage fileStorage.Interface, eventbus MetaEventbusInterface) error {
-	currentState, err := makeDbState(secondaryDekanatDb)
+// checkResult - outcome of checkDekanatDb iteration
+type checkResult struct {
+	Status        string
+	PreviousState dbState
+	CurrentState  dbState
+	Sessions      loadSessions
+	Candidate     *stabilityCandidate `json:",omitempty"`
+	Restore       restoreActivity
+	// FullReload - database file is replaced, so the whole DB should be reloaded
+	FullReload bool
+}
+
+// loadDetails - information about the load which is not part of SecondaryDbLoadedEvent payload
+type loadDetails struct {
+	Sessions   loadSessions
+	Identity   dbIdentity
+	FullReload bool
+	// Transition - announced state change, written to audit log
+	Transition stateTransition
+}
+
+// stateTransition - stored state before and after announcement
+type stateTransition struct {
+	Before dbState
+	After  dbState
+}
+
+// loadSessions - TSESS_LOG sessions since previous announced state: one full restore or several incremental loads
+type loadSessions struct {
+	Count         int
+	FirstDatetime time.Time
+	LastDatetime  time.Time
+}
+
+const CheckResultUnchanged = "unchanged"
+const CheckResultAnnounced = "announced"
+const CheckResultStandby = "standby"
+const CheckResultCandidate = "candidate"
+const CheckResultRestoreInProgress = "restoreInProgress"
+
+// checkDekanatDb announces new DB state, with stability policy only after DB stays unchanged
+// and with restore detector only when restore is not running (nil disables both)
+func checkDekanatDb(
+	secondaryDekanatDb *sql.DB, storage fileStorage.Interface, eventbus MetaEventbusInterface,
+	stability *StabilityPolicy, restoreDetector *RestoreDetector,
+) (checkResult, error) {
+	var result checkResult
+	var err error
+
+	result.CurrentState, err = makeDbState(secondaryDekanatDb)
 	if err != nil {
-		return errors.New("Failed to get DB state: " + err.Error())
+		return result, fmt.Errorf("Failed to get DB state: %w", err)
 	}
 
-	var previousState dbState
+	var previousDocument stateDocument
 	previousStateSerialized, err := storage.Get()
 
-	if err == nil && previousStateSerialized != nil && len(previousStateSerialized) > 10 {
-		err = json.Unmarshal(previousStateSerialized, &previousState)
+	if err == nil {
+		previousDocument, err = unmarshalStateDocument(previousStateSerialized)
 	}
 
 	if err != nil {
-		return errors.New("Failed to get previous DB state from Storage: " + err.Error())
+		return result, classifyError(StorageUnreadableError, errors.New("Failed to get previous DB state from Storage: "+err.Error()))
 	}
 
+	currentState := result.CurrentState
+	previousState := previousDocument.State
+	result.PreviousState = previousState
+	result.Status = CheckResultUnchanged
+
 	if previousState.isEqual(currentState) {
-		return nil
+		return result, nil
+	}
+
+	result.FullReload = previousState.Identity.isReplacedBy(currentState.Identity)
+
+	// skip if current db state is less than 3 hours from previous, replaced database is announced regardless of time
+	if !result.FullReload && currentState.ActualDatetime.Sub(previousState.ActualDatetime) < time.Hour*3 {
+		return result, nil
+	}
+
+	if restoreDetector != nil {
+		result.Restore, err = restoreDetector.detect(secondaryDekanatDb)
+		if err != nil {
+			return result, classifyError(dbErrorClass(err), fmt.Errorf("Failed to check restore activity: %w", err))
+		}
+
+		if result.Restore.isRunning() {
+			result.Status = CheckResultRestoreInProgress
+			return result, nil
+		}
+	}
+
+	if stability != nil {
+		candidate, stable := stability.observe(previousDocument.Candidate, currentState, time.Now())
+		if !stable {
+			previousDocument.Candidate = &candidate
+			result.Status = CheckResultCandidate
+			result.Candidate = &candidate
+			return result, saveCandidate(storage, previousDocument.marshal())
+		}
 	}
 
-	// skip if current db state is less than 3 hours from previous
-	if currentState.ActualDatetime.Sub(previousState.ActualDatetime) < time.Hour*3 {
-		return nil
+	// sessions are unknown when previous state was stored before session tracking or database is replaced
+	if previousState.LastSessionId != 0 && !result.FullReload {
+		result.Sessions, err = getNewSessions(secondaryDekanatDb, previousState.LastSessionId, currentState.LastSessionId)
+		if err != nil {
+			return result, classifyError(dbErrorClass(err), fmt.Errorf("Failed to get new sessions from DB: %w", err))
+		}
 	}
 
-	currentStateSerialized, _ := json.Marshal(currentState)
-	err = storage.Set(currentStateSerialized)
+	err = storage.Set(previousDocument.next(currentState).marshal())
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	if currentState.EducationYear != previousState.EducationYear {
-		err = eventbus.sendCurrentYearEvent(currentState.EducationYear)
+		err = eventbus.sendCurrentYearEvent(currentState.EducationYear, stateTransition{Before: previousState, After: currentState})
 		if err != nil {
-			_ = storage.Set(previousStateSerialized)
-			return errors.New("Failed to send Current year event to Kafka: " + err.Error())
+			return result, rollbackState(storage, previousStateSerialized, classifyError(
+				KafkaUnreachableError, errors.New("Failed to send Current year event to Kafka: "+err.Error()),
+			))
 		}
 	}
 
 	err = eventbus.sendSecondaryDbLoadedEvent(
 		currentState.ActualDatetime, previousState.ActualDatetime,
-		currentState.EducationYear,
+		currentState.EducationYear, loadDetails{
+			Sessions:   result.Sessions,
+			Identity:   currentState.Identity,
+			FullReload: result.FullReload,
+			Transition: stateTransition{Before: previousState, After: currentState},
+		},
 	)
 	if err != nil {
-		_ = storage.Set(previousStateSerialized)
-		return errors.New("Failed to send Secondary DB loaded Event to Kafka: " + err.Error())
+		return result, rollbackState(storage, previousStateSerialized, classifyError(
+			KafkaUnreachableError, errors.New("Failed to send Secondary DB loaded Event to Kafka: "+err.Error()),
+		))
+	}
+
+	if stability != nil {
+		stability.announced()
+	}
+
+	result.Status = CheckResultAnnounced
+	return result, nil
+}
+
+// rollbackState restores previous state after failed announcement, so the load is announced on the next iteration
+func rollbackState(storage fileStorage.Interface, previousStateSerialized []byte, err error) error {
+	rollbackErr := restoreStorage(storage, previousStateSerialized)
+	if rollbackErr != nil {
+		return fmt.Errorf("%w, failed to restore previous state, load could be not announced: %s", err, rollbackErr)
 	}
 
-	return nil
+	return err
 }
 
 // drop "+02:00" , "+03:00" etc in the end
 var removeTimeZone = regexp.MustCompile(`\+[0-9]{2}:[0-9]{2}$`)
 var removeMilliseconds = regexp.MustCompile(`\.[0-9]{3}`)
 
-func getDbStateDatetime(secondaryDekanatDb *sql.DB) (time.Time, error) {
+func getLastSession(secondaryDekanatDb *sql.DB) (int64, time.Time, error) {
 	err := secondaryDekanatDb.Ping()
 	if err != nil {
-		return time.Time{}, err
+		return 0, time.Time{}, classifyError(DbUnreachableError, err)
 	}
 
+	var id int64
 	var lastDatetimeString string
-	rows := secondaryDekanatDb.QueryRow(GetLastDatetimeQuery)
+	rows := secondaryDekanatDb.QueryRow(GetLastSessionQuery)
 	if rows.Err() != nil {
-		return time.Time{}, rows.Err()
+		return 0, time.Time{}, rows.Err()
 	}
 
-	err = rows.Scan(&lastDatetimeString)
+	err = rows.Scan(&id, &lastDatetimeString)
 	if lastDatetimeString == "" || err != nil {
-		return time.Time{}, errors.New(fmt.Sprintf("empty last date from DB: %s", err))
+		return 0, time.Time{}, fmt.Errorf("empty last date from DB: %w", err)
+	}
+
+	lastDatetime, err := parseFirebirdDatetime(lastDatetimeString)
+	return id, lastDatetime, err
+}
+
+func getNewSessions(secondaryDekanatDb *sql.DB, previousSessionId int64, lastSessionId int64) (sessions loadSessions, err error) {
+	rows, err := secondaryDekanatDb.Query(GetNewSessionsQuery, previousSessionId, lastSessionId)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	var id int64
+	var datetimeString string
+	var datetime time.Time
+	for rows.Next() {
+		err = rows.Scan(&id, &datetimeString)
+		if err == nil {
+			datetime, err = parseFirebirdDatetime(datetimeString)
+		}
+		if err != nil {
+			return sessions, errors.New(fmt.Sprintf("wrong session %d: %s", id, err))
+		}
+
+		if sessions.Count == 0 {
+			sessions.FirstDatetime = datetime
+		}
+		sessions.LastDatetime = datetime
+		sessions.Count++
 	}
 
-	lastDatetimeString = strings.Replace(lastDatetimeString, "Z", "", 1)
-	lastDatetimeString = removeTimeZone.ReplaceAllString(lastDatetimeString, "")
-	lastDatetimeString = removeMilliseconds.ReplaceAllString(lastDatetimeString, "")
+	return sessions, rows.Err()
+}
+
+func parseFirebirdDatetime(datetimeString string) (time.Time, error) {
+	datetimeString = strings.Replace(datetimeString, "Z", "", 1)
+	datetimeString = removeTimeZone.ReplaceAllString(datetimeString, "")
+	datetimeString = removeMilliseconds.ReplaceAllString(datetimeString, "")
 
-	return time.ParseInLocation(FirebirdTimeFormat, lastDatetimeString, time.Local)
+	return time.ParseInLocation(FirebirdTimeFormat, datetimeString, time.Local)
 }
 
 func getCurrentYear(secondaryDekanatDb *sql.DB) (int, error) {
@@ -122,7 +269,11 @@ func getCurrentYear(secondaryDekanatDb *sql.DB) (int, error) {
 
 	err := rows.Scan(&firstLessonRegDateString)
 	if err != nil {
-		return 0, errors.New(fmt.Sprintf("empty last date from DB: %s", err))
+		return 0, fmt.Errorf("empty last date from DB: %w", err)
+	}
+
+	if len(firstLessonRegDateString) < 10 {
+		return 0, errors.New(fmt.Sprintf("wrong first lesson registration date: %q", firstLessonRegDateString))
 	}
 
 	// git first 10 chars of string, like "2024-09-02"
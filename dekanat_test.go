@@ -1,30 +1,57 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	fileStorageMocks "github.com/kneu-messenger-pigeon/fileStorage/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"log"
+	"regexp"
 	"testing"
 	"time"
 )
 
+const testLastSessionId = 100
+
+var testIdentity = dbIdentity{
+	CreationDate: time.Date(2023, 9, 1, 2, 0, 0, 0, time.Local),
+	Guid:         "{6F9619FF-8B86-D011-B42D-00C04FC964FF}",
+	OdsVersion:   "13.0",
+}
+
 func newDekanatDbMock(lastDatetime interface{}, firstLessonReg interface{}) *sql.DB {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		log.Fatalf("an error '%s' was not expected when opening a mock database connection", err)
 	}
 
-	setQueryResult(mock, GetLastDatetimeQuery, lastDatetime)
+	setQueryResult(mock, GetLastSessionQuery, lastDatetime)
 	setQueryResult(mock, GetFirstLessonRegDateQuery, firstLessonReg)
+	setIdentityResult(mock, testIdentity)
 
 	return db
 }
 
+func setIdentityResult(mock sqlmock.Sqlmock, identity dbIdentity) {
+	mock.ExpectQuery(regexp.QuoteMeta(GetDbIdentityQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"MON$CREATION_DATE", "MON$ODS_MAJOR", "MON$ODS_MINOR", "MON$GUID"}).
+			AddRow(identity.CreationDate, 13, 0, identity.Guid),
+	)
+}
+
 func setQueryResult(mock sqlmock.Sqlmock, query string, returnValue interface{}) {
+	columns := []string{"CON_DATA"}
+	var row []driver.Value
+	if query == GetLastSessionQuery {
+		columns = []string{"ID", "CON_DATA"}
+		row = []driver.Value{testLastSessionId}
+	}
+
 	switch returnValue.(type) {
 	case error:
 		mock.ExpectQuery(query).WillReturnError(returnValue.(error))
@@ -33,21 +60,21 @@ func setQueryResult(mock sqlmock.Sqlmock, query string, returnValue interface{})
 		Time := returnValue.(time.Time)
 
 		mock.ExpectQuery(query).WillReturnRows(
-			sqlmock.NewRows([]string{"CON_DATA"}).AddRow(Time.Format(FirebirdTimeFormat)),
+			sqlmock.NewRows(columns).AddRow(append(row, Time.Format(FirebirdTimeFormat))...),
 		)
 
 	case string:
 		mock.ExpectQuery(query).WillReturnRows(
-			sqlmock.NewRows([]string{"CON_DATA"}).AddRow(returnValue),
+			sqlmock.NewRows(columns).AddRow(append(row, returnValue)...),
 		)
 	case nil:
 		mock.ExpectQuery(query).WillReturnRows(
-			sqlmock.NewRows([]string{"CON_DATA"}),
+			sqlmock.NewRows(columns),
 		)
 	}
 }
 
-func TestGetDbStateDatetime(t *testing.T) {
+func TestGetLastSession(t *testing.T) {
 	var db *sql.DB
 	var expectedDatetime time.Time
 	var expectedRegDate time.Time
@@ -61,11 +88,11 @@ func TestGetDbStateDatetime(t *testing.T) {
 		expectedRegDate = time.Date(2022, 9, 3, 0, 0, 0, 0, time.Local)
 		db = newDekanatDbMock(expectedDatetime, expectedRegDate)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.NoError(t, actualErr)
 		assert.Equalf(t, expectedDatetime, actualDatetime,
-			"Expect getDbStateDatetime(db) = %s, actual: %s", expectedDatetime, actualDatetime,
+			"Expect getLastSession(db) = %s, actual: %s", expectedDatetime, actualDatetime,
 		)
 	})
 
@@ -76,11 +103,11 @@ func TestGetDbStateDatetime(t *testing.T) {
 		expectedDatetimeString := "2022-11-02T04:00:00.123Z"
 		db = newDekanatDbMock(expectedDatetimeString, expectedDatetime)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.NoError(t, actualErr)
 		assert.Equalf(t, expectedDatetime, actualDatetime,
-			"Expect getDbStateDatetime(db) = %s, actual: %s", expectedDatetime, actualDatetime,
+			"Expect getLastSession(db) = %s, actual: %s", expectedDatetime, actualDatetime,
 		)
 	})
 
@@ -88,11 +115,11 @@ func TestGetDbStateDatetime(t *testing.T) {
 		expectedErr = errors.New("cannot parse \"invalid\" as")
 		db = newDekanatDbMock("invalid", nil)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.Error(t, actualErr)
 		assert.Containsf(t, actualErr.Error(), expectedErr.Error(),
-			"Expect getDbStateDatetime(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
+			"Expect getLastSession(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
 		)
 	})
 
@@ -100,11 +127,11 @@ func TestGetDbStateDatetime(t *testing.T) {
 		expectedErr = errors.New("dummy error")
 		db = newDekanatDbMock(expectedErr, nil)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.Error(t, actualErr)
 		assert.Containsf(t, actualErr.Error(), expectedErr.Error(),
-			"Expect getDbStateDatetime(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
+			"Expect getLastSession(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
 		)
 	})
 
@@ -112,11 +139,11 @@ func TestGetDbStateDatetime(t *testing.T) {
 		expectedErr = errors.New("empty last date from DB: sql: no rows in result set")
 		db = newDekanatDbMock(nil, nil)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.Error(t, actualErr)
 		assert.Equalf(t, actualErr.Error(), expectedErr.Error(),
-			"Expect getDbStateDatetime(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
+			"Expect getLastSession(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
 		)
 	})
 
@@ -126,14 +153,23 @@ func TestGetDbStateDatetime(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
 		mock.ExpectPing().WillReturnError(expectedErr)
 
-		actualDatetime, actualErr = getDbStateDatetime(db)
+		_, actualDatetime, actualErr = getLastSession(db)
 
 		assert.Error(t, actualErr)
 		assert.Equalf(t, actualErr.Error(), expectedErr.Error(),
-			"Expect getDbStateDatetime(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
+			"Expect getLastSession(db) = nil, %s, actual: %s, %s", expectedErr, actualDatetime, actualErr,
 		)
 	})
 
+	t.Run("db ping fails with file error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		mock.ExpectPing().WillReturnError(errors.New(`I/O error during "open" operation for file "/data/dekanat.fdb"`))
+
+		_, err := makeDbState(db)
+
+		assert.ErrorIs(t, err, DbUnreachableError)
+		assert.Equal(t, ExitCodeDbUnreachable, getExitCode(err))
+	})
 }
 
 func TestExtractEducationYearValidInput(t *testing.T) {
@@ -191,8 +227,15 @@ func TestCheckDekanatDb(t *testing.T) {
 	loc := time.Local
 
 	var serializeState = func(state dbState) []byte {
-		s, _ := json.Marshal(state)
-		return s
+		return stateDocument{State: state}.marshal()
+	}
+
+	var serializeNextState = func(previousState dbState, state dbState) []byte {
+		return stateDocument{State: previousState}.next(state).marshal()
+	}
+
+	var expectedTransition = func() stateTransition {
+		return stateTransition{Before: previousState, After: expectedState}
 	}
 
 	t.Run("changeEducationYear", func(t *testing.T) {
@@ -204,31 +247,33 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 15, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, expectedState.ActualDatetime)
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
 
 		producer = NewMockMetaEventbusInterface(t)
-		producer.On("sendCurrentYearEvent", 2023).Return(nil)
+		producer.On("sendCurrentYearEvent", 2023, expectedTransition()).Return(nil)
 		producer.On(
 			"sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		).Return(nil)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
 
 		producer.AssertCalled(
 			t, "sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		)
-		producer.AssertCalled(t, "sendCurrentYearEvent", 2023)
-		storageInstance.AssertCalled(t, "Set", serializeState(expectedState))
+		producer.AssertCalled(t, "sendCurrentYearEvent", 2023, expectedTransition())
+		storageInstance.AssertCalled(t, "Set", serializeNextState(previousState, expectedState))
 	})
 
 	t.Run("ErrorSendCurrentYearEvent", func(t *testing.T) {
@@ -240,6 +285,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 15, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		expectedError = errors.New("dummy error sendCurrentYearEvent")
@@ -248,19 +295,19 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
 		storageInstance.On("Set", serializeState(previousState)).Return(nil)
 
 		producer = NewMockMetaEventbusInterface(t)
-		producer.On("sendCurrentYearEvent", 2023).Return(expectedError)
+		producer.On("sendCurrentYearEvent", 2023, expectedTransition()).Return(expectedError)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "checkDekanat should fails with error")
 
 		producer.AssertNotCalled(t, "sendSecondaryDbLoadedEvent")
-		producer.AssertCalled(t, "sendCurrentYearEvent", 2023)
-		storageInstance.AssertCalled(t, "Set", serializeState(expectedState))
+		producer.AssertCalled(t, "sendCurrentYearEvent", 2023, expectedTransition())
+		storageInstance.AssertCalled(t, "Set", serializeNextState(previousState, expectedState))
 		storageInstance.AssertCalled(t, "Set", serializeState(previousState))
 	})
 
@@ -273,31 +320,283 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
 
 		producer = NewMockMetaEventbusInterface(t)
 		producer.On(
 			"sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		).Return(nil)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		result, err := checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.Equal(t, CheckResultAnnounced, result.Status)
 
 		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
 
 		producer.AssertCalled(
 			t, "sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		)
 
 		producer.AssertNumberOfCalls(t, "sendCurrentYearEvent", 0)
-		storageInstance.AssertCalled(t, "Set", serializeState(expectedState))
+		storageInstance.AssertCalled(t, "Set", serializeNextState(previousState, expectedState))
+	})
+
+	t.Run("ChangeDatetimeWithNewSessions", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  97,
+		}
+
+		expectedState = dbState{
+			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
+		}
+
+		expectedSessions := loadSessions{
+			Count:         2,
+			FirstDatetime: time.Date(2023, 9, 12, 1, 30, 0, 0, loc),
+			LastDatetime:  expectedState.ActualDatetime,
+		}
+
+		var mock sqlmock.Sqlmock
+		db, mock, _ = sqlmock.New()
+		setQueryResult(mock, GetLastSessionQuery, expectedState.ActualDatetime)
+		setQueryResult(mock, GetFirstLessonRegDateQuery, "2023-09-02")
+		setIdentityResult(mock, testIdentity)
+		mock.ExpectQuery(regexp.QuoteMeta(GetNewSessionsQuery)).WithArgs(int64(97), int64(testLastSessionId)).WillReturnRows(
+			sqlmock.NewRows([]string{"ID", "CON_DATA"}).
+				AddRow(99, expectedSessions.FirstDatetime.Format(FirebirdTimeFormat)).
+				AddRow(100, expectedSessions.LastDatetime.Format(FirebirdTimeFormat)),
+		)
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+		producer.On(
+			"sendSecondaryDbLoadedEvent",
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Sessions: expectedSessions, Identity: testIdentity},
+		).Return(nil)
+
+		result, err := checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
+		assert.Equal(t, CheckResultAnnounced, result.Status)
+		assert.Equal(t, expectedSessions, result.Sessions)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NewSessionsError", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  97,
+		}
+
+		var mock sqlmock.Sqlmock
+		db, mock, _ = sqlmock.New()
+		setQueryResult(mock, GetLastSessionQuery, time.Date(2023, 9, 12, 4, 0, 0, 0, loc))
+		setQueryResult(mock, GetFirstLessonRegDateQuery, "2023-09-02")
+		setIdentityResult(mock, testIdentity)
+		mock.ExpectQuery(regexp.QuoteMeta(GetNewSessionsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"ID", "CON_DATA"}).AddRow(99, "invalid"),
+		)
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to get new sessions from DB: wrong session 99")
+		storageInstance.AssertNumberOfCalls(t, "Set", 0)
+		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 0)
+	})
+
+	t.Run("NewStateIsCandidate", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+		}
+
+		expectedState = dbState{
+			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
+		}
+
+		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
+
+		var storedDocument stateDocument
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+		storageInstance.On("Set", mock.Anything).Run(func(args mock.Arguments) {
+			storedDocument, _ = unmarshalStateDocument(args.Get(0).([]byte))
+		}).Return(nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+
+		stability := NewStabilityPolicy(Config{stabilityChecks: 2})
+		result, err := checkDekanatDb(db, storageInstance, producer, stability, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, CheckResultCandidate, result.Status)
+		assert.Equal(t, 1, result.Candidate.Checks)
+		assert.True(t, previousState.isEqual(storedDocument.State), "announced state should not be changed")
+		assert.True(t, expectedState.isEqual(storedDocument.Candidate.State))
+		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 0)
+
+		// the same state on the next check is stable
+		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(storedDocument.marshal(), nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
+
+		producer.On(
+			"sendSecondaryDbLoadedEvent",
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
+		).Return(nil)
+
+		result, err = checkDekanatDb(db, storageInstance, producer, stability, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, CheckResultAnnounced, result.Status)
+		assert.Equal(t, stabilityStatus{RequiredChecks: 2}, stability.status())
+	})
+
+	t.Run("RestoreInProgress", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+		}
+
+		var mock sqlmock.Sqlmock
+		db, mock, _ = sqlmock.New()
+		setQueryResult(mock, GetLastSessionQuery, time.Date(2023, 9, 12, 4, 0, 0, 0, loc))
+		setQueryResult(mock, GetFirstLessonRegDateQuery, "2023-09-02")
+		setIdentityResult(mock, testIdentity)
+		mock.ExpectQuery(regexp.QuoteMeta(GetAttachmentsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$USER", "MON$REMOTE_PROCESS"}).AddRow("LOADER", "gbak"),
+		)
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+
+		restoreDetector := NewRestoreDetector(&bytes.Buffer{}, Config{restoreLoaderUsers: []string{"LOADER"}})
+		result, err := checkDekanatDb(db, storageInstance, producer, nil, restoreDetector)
+
+		assert.NoError(t, err)
+		assert.Equal(t, CheckResultRestoreInProgress, result.Status)
+		assert.Equal(t, []string{"LOADER@gbak"}, result.Restore.LoaderAttachments)
+		storageInstance.AssertNumberOfCalls(t, "Set", 0)
+		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 0)
+	})
+
+	t.Run("DatabaseReplaced", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 12, 3, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity: dbIdentity{
+				CreationDate: time.Date(2023, 8, 1, 2, 0, 0, 0, loc),
+				Guid:         "{OLD}",
+				OdsVersion:   "13.0",
+			},
+		}
+
+		expectedState = dbState{
+			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
+		}
+
+		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+		producer.On(
+			"sendSecondaryDbLoadedEvent",
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			loadDetails{Transition: expectedTransition(), Identity: testIdentity, FullReload: true},
+		).Return(nil)
+
+		result, err := checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, CheckResultAnnounced, result.Status, "replaced database is announced regardless of 3 hours rule")
+		assert.True(t, result.FullReload)
+	})
+
+	t.Run("LegacyPreviousState", func(t *testing.T) {
+		previousState = dbState{
+			ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+		}
+
+		expectedState = dbState{
+			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
+		}
+
+		legacySerializedState, _ := json.Marshal(previousState)
+
+		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(legacySerializedState, nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+		producer.On(
+			"sendSecondaryDbLoadedEvent",
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
+		).Return(nil)
+
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
+		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 1)
+		producer.AssertNumberOfCalls(t, "sendCurrentYearEvent", 0)
+	})
+
+	t.Run("UnsupportedPreviousStateVersion", func(t *testing.T) {
+		db = newDekanatDbMock(time.Date(2023, 9, 12, 4, 0, 0, 0, loc), "2023-09-02")
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return([]byte(`{"Version":999,"State":{}}`), nil)
+
+		producer = NewMockMetaEventbusInterface(t)
+
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported state version 999")
+		storageInstance.AssertNumberOfCalls(t, "Set", 0)
 	})
 
 	t.Run("ErrorSendSecondaryDbLoadedEvent", func(t *testing.T) {
@@ -309,13 +608,15 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
 		storageInstance.On("Set", serializeState(previousState)).Return(nil)
 
 		expectedError = errors.New("dummy error sendCurrentYearEvent")
@@ -323,22 +624,39 @@ func TestCheckDekanatDb(t *testing.T) {
 		producer = NewMockMetaEventbusInterface(t)
 		producer.On(
 			"sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		).Return(expectedError)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "expect checkDekanat fails")
 
 		producer.AssertCalled(
 			t, "sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		)
 		producer.AssertNotCalled(t, "sendCurrentYearEvent")
-		storageInstance.AssertCalled(t, "Set", serializeState(expectedState))
+		storageInstance.AssertCalled(t, "Set", serializeNextState(previousState, expectedState))
 		storageInstance.AssertCalled(t, "Set", serializeState(previousState))
 	})
 
+	t.Run("ErrorRollbackAfterFailedSend", func(t *testing.T) {
+		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
+
+		storageInstance = fileStorageMocks.NewInterface(t)
+		storageInstance.On("Get").Return(serializeState(previousState), nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
+		storageInstance.On("Set", serializeState(previousState)).Return(errors.New("disk is full"))
+
+		producer = NewMockMetaEventbusInterface(t)
+		producer.On("sendSecondaryDbLoadedEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("kafka is down"))
+
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.ErrorIs(t, err, KafkaUnreachableError)
+		assert.Equal(t, "Failed to send Secondary DB loaded Event to Kafka: kafka is down, failed to restore previous state, load could be not announced: disk is full", err.Error())
+	})
+
 	t.Run("NoChangeDatetime", func(t *testing.T) {
 		previousState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, loc),
@@ -348,6 +666,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
@@ -356,7 +676,9 @@ func TestCheckDekanatDb(t *testing.T) {
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
 
 		producer = NewMockMetaEventbusInterface(t)
-		err = checkDekanatDb(db, storageInstance, producer)
+		result, err := checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.Equal(t, CheckResultUnchanged, result.Status)
 
 		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
 
@@ -374,6 +696,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 6, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
@@ -382,7 +706,7 @@ func TestCheckDekanatDb(t *testing.T) {
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
 
 		producer = NewMockMetaEventbusInterface(t)
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.NoErrorf(t, err, "checkDekanat failed with error: %s", err)
 	})
@@ -394,7 +718,7 @@ func TestCheckDekanatDb(t *testing.T) {
 		storageInstance = fileStorageMocks.NewInterface(t)
 		producer = NewMockMetaEventbusInterface(t)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "checkDekanat not failed with error")
 		assert.Containsf(t, err.Error(), expectedError.Error(), "Expected %s, acutal %s", expectedError, err)
@@ -413,6 +737,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock("2000-01-01T04:00:00Z", "2000-09-02")
@@ -422,7 +748,7 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		expectedError = errors.New("failed to detect current education year")
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "Failed to get last datetime from DB: parsing time \"DUMMY_INVALID_DATETIME\" as \"2006-01-02T15:04:05+0")
 		assert.Containsf(
@@ -443,7 +769,7 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		expectedError = errors.New("failed to detect current education year")
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err)
 		assert.Containsf(
@@ -466,7 +792,7 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		expectedError = errors.New("failed to detect current education year")
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err)
 		assert.Containsf(
@@ -487,7 +813,7 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		expectedError = errors.New("failed to detect current education year")
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err)
 		assert.Containsf(
@@ -500,6 +826,19 @@ func TestCheckDekanatDb(t *testing.T) {
 		storageInstance.AssertNumberOfCalls(t, "Set", 0)
 	})
 
+	t.Run("DekanatDbShortDateEducationYear", func(t *testing.T) {
+		db = newDekanatDbMock("2000-01-01T04:00:00Z", "2023-09")
+		storageInstance = fileStorageMocks.NewInterface(t)
+
+		producer = NewMockMetaEventbusInterface(t)
+
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "wrong first lesson registration date: \"2023-09\"")
+		storageInstance.AssertNumberOfCalls(t, "Set", 0)
+	})
+
 	t.Run("DekanatDbSecondSemesterDateEducationYear", func(t *testing.T) {
 		previousState = dbState{
 			ActualDatetime: time.Date(2023, 4, 14, 4, 0, 0, 0, loc),
@@ -509,21 +848,23 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 4, 15, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2024-04-15")
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(nil)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(nil)
 
 		producer = NewMockMetaEventbusInterface(t)
 		producer.On(
 			"sendSecondaryDbLoadedEvent",
-			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear,
+			expectedState.ActualDatetime, previousState.ActualDatetime, expectedState.EducationYear, loadDetails{Transition: expectedTransition(), Identity: testIdentity},
 		).Return(nil)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.NoError(t, err)
 		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 1)
@@ -539,6 +880,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
@@ -550,7 +893,7 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		producer = NewMockMetaEventbusInterface(t)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "checkDekanat not failed with error")
 		assert.Containsf(t, err.Error(), expectedError.Error(),
@@ -571,6 +914,8 @@ func TestCheckDekanatDb(t *testing.T) {
 		expectedState = dbState{
 			ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, loc),
 			EducationYear:  2023,
+			LastSessionId:  testLastSessionId,
+			Identity:       testIdentity,
 		}
 
 		db = newDekanatDbMock(expectedState.ActualDatetime, "2023-09-02")
@@ -580,17 +925,17 @@ func TestCheckDekanatDb(t *testing.T) {
 
 		storageInstance = fileStorageMocks.NewInterface(t)
 		storageInstance.On("Get").Return(serializeState(previousState), nil)
-		storageInstance.On("Set", serializeState(expectedState)).Return(expectedError)
+		storageInstance.On("Set", serializeNextState(previousState, expectedState)).Return(expectedError)
 
 		producer = NewMockMetaEventbusInterface(t)
 
-		err = checkDekanatDb(db, storageInstance, producer)
+		_, err = checkDekanatDb(db, storageInstance, producer, nil, nil)
 
 		assert.Error(t, err, "checkDekanat not failed with error")
 		assert.Containsf(t, err.Error(), expectedError.Error(), "Expected %s, acutal %s", expectedError, err)
 
 		producer.AssertNumberOfCalls(t, "sendSecondaryDbLoadedEvent", 0)
 		producer.AssertNumberOfCalls(t, "sendCurrentYearEvent", 0)
-		storageInstance.AssertCalled(t, "Set", serializeState(expectedState))
+		storageInstance.AssertCalled(t, "Set", serializeNextState(previousState, expectedState))
 	})
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type iterationOutcome struct {
+	finishedAt time.Time
+	failed     bool
+}
+
+// ErrorBudget - windowed error policy: break if more than maxErrors errors happened
+// in the last window duration or in the last windowIterations iterations, windows are evaluated separately.
+// Unlike consecutive error count, it is not reset by a single successful iteration, so flapping DB trips it too.
+type ErrorBudget struct {
+	maxErrors        int
+	window           time.Duration
+	windowIterations int
+
+	mutex    sync.Mutex
+	outcomes []iterationOutcome
+}
+
+type errorBudgetStatus struct {
+	MaxErrors        int
+	Window           string `json:",omitempty"`
+	WindowIterations int    `json:",omitempty"`
+	Errors           int
+	Iterations       int
+}
+
+func NewErrorBudget(config Config) *ErrorBudget {
+	return &ErrorBudget{
+		maxErrors:        config.errorWindowMaxErrors,
+		window:           config.errorWindowDuration,
+		windowIterations: config.errorWindowIterations,
+	}
+}
+
+// enabled - without ERROR_WINDOW_MAX_ERRORS the main loop uses consecutive error count
+func (budget *ErrorBudget) enabled() bool {
+	return budget.maxErrors > 0
+}
+
+// record adds iteration outcome and returns true when budget is exceeded
+func (budget *ErrorBudget) record(now time.Time, failed bool) bool {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.outcomes = append(budget.outcomes, iterationOutcome{finishedAt: now, failed: failed})
+	budget.prune(now)
+
+	return countErrors(budget.worstWindow(now).outcomes) > budget.maxErrors
+}
+
+// reset forgets errors before in-process recovery
+func (budget *ErrorBudget) reset() {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.outcomes = nil
+}
+
+// usage - errors and iterations of the window with the most errors
+func (budget *ErrorBudget) usage(now time.Time) (errorCount int, iterations int) {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.prune(now)
+	worst := budget.worstWindow(now)
+	return countErrors(worst.outcomes), len(worst.outcomes)
+}
+
+func (budget *ErrorBudget) describe(now time.Time) string {
+	budget.mutex.Lock()
+	budget.prune(now)
+	worst := budget.worstWindow(now)
+	budget.mutex.Unlock()
+
+	description := fmt.Sprintf(
+		"error budget: %d/%d errors in last %d iterations", countErrors(worst.outcomes), budget.maxErrors, len(worst.outcomes),
+	)
+	if worst.duration > 0 {
+		description += " within " + worst.duration.String()
+	}
+
+	return description
+}
+
+func (budget *ErrorBudget) status() interface{} {
+	errorCount, iterations := budget.usage(time.Now())
+
+	status := errorBudgetStatus{
+		MaxErrors:        budget.maxErrors,
+		WindowIterations: budget.windowIterations,
+		Errors:           errorCount,
+		Iterations:       iterations,
+	}
+	if budget.window > 0 {
+		status.Window = budget.window.String()
+	}
+
+	return status
+}
+
+// errorWindow - outcomes of the last iterations or of the last duration
+type errorWindow struct {
+	outcomes []iterationOutcome
+	duration time.Duration
+}
+
+// windows evaluates duration and iterations windows separately, should be called under mutex.
+// Without windows all outcomes since start or reset are counted.
+func (budget *ErrorBudget) windows(now time.Time) []errorWindow {
+	var windows []errorWindow
+	if budget.windowIterations > 0 {
+		start := max(0, len(budget.outcomes)-budget.windowIterations)
+		windows = append(windows, errorWindow{outcomes: budget.outcomes[start:]})
+	}
+
+	if budget.window > 0 {
+		start := 0
+		for start < len(budget.outcomes) && now.Sub(budget.outcomes[start].finishedAt) > budget.window {
+			start++
+		}
+		windows = append(windows, errorWindow{outcomes: budget.outcomes[start:], duration: budget.window})
+	}
+
+	if len(windows) == 0 {
+		windows = append(windows, errorWindow{outcomes: budget.outcomes})
+	}
+
+	return windows
+}
+
+// worstWindow - budget is exceeded when either window has too many errors, should be called under mutex
+func (budget *ErrorBudget) worstWindow(now time.Time) errorWindow {
+	windows := budget.windows(now)
+	worst := windows[0]
+	for _, window := range windows[1:] {
+		if countErrors(window.outcomes) > countErrors(worst.outcomes) {
+			worst = window
+		}
+	}
+
+	return worst
+}
+
+// prune drops outcomes outside of all windows, should be called under mutex
+func (budget *ErrorBudget) prune(now time.Time) {
+	// windows are suffixes of outcomes, the longest one contains others
+	longest := budget.outcomes[len(budget.outcomes):]
+	for _, window := range budget.windows(now) {
+		if len(window.outcomes) > len(longest) {
+			longest = window.outcomes
+		}
+	}
+
+	budget.outcomes = longest
+}
+
+func countErrors(outcomes []iterationOutcome) int {
+	errorCount := 0
+	for _, outcome := range outcomes {
+		if outcome.failed {
+			errorCount++
+		}
+	}
+
+	return errorCount
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestErrorBudget(t *testing.T) {
+	t.Run("Flapping iterations trip budget", func(t *testing.T) {
+		budget := NewErrorBudget(Config{errorWindowMaxErrors: 2, errorWindowIterations: 10})
+		now := time.Now()
+
+		assert.True(t, budget.enabled())
+		assert.False(t, budget.record(now, true))
+		assert.False(t, budget.record(now, false))
+		assert.False(t, budget.record(now, true))
+		assert.False(t, budget.record(now, false))
+		assert.True(t, budget.record(now, true))
+
+		errorCount, iterations := budget.usage(now)
+		assert.Equal(t, 3, errorCount)
+		assert.Equal(t, 5, iterations)
+		assert.Equal(t, "error budget: 3/2 errors in last 5 iterations", budget.describe(now))
+	})
+
+	t.Run("Iterations window", func(t *testing.T) {
+		budget := NewErrorBudget(Config{errorWindowMaxErrors: 1, errorWindowIterations: 3})
+		now := time.Now()
+
+		assert.False(t, budget.record(now, true))
+		assert.False(t, budget.record(now, false))
+		assert.False(t, budget.record(now, false))
+		assert.False(t, budget.record(now, true))
+
+		errorCount, iterations := budget.usage(now)
+		assert.Equal(t, 1, errorCount)
+		assert.Equal(t, 3, iterations)
+	})
+
+	t.Run("Duration window", func(t *testing.T) {
+		budget := NewErrorBudget(Config{errorWindowMaxErrors: 1, errorWindowDuration: time.Minute * 10})
+		now := time.Now()
+
+		assert.False(t, budget.record(now.Add(-time.Minute*25), true))
+		assert.False(t, budget.record(now.Add(-time.Minute*5), true))
+		assert.True(t, budget.record(now, true))
+
+		errorCount, iterations := budget.usage(now.Add(time.Minute * 6))
+		assert.Equal(t, 1, errorCount)
+		assert.Equal(t, 1, iterations)
+
+		assert.Equal(t, errorBudgetStatus{MaxErrors: 1, Window: "10m0s", Errors: 1, Iterations: 1}, budget.status())
+	})
+
+	t.Run("Duration or iterations window", func(t *testing.T) {
+		now := time.Now()
+
+		// 3 errors in the last 3 iterations, but spread over 30 minutes: iterations window is exceeded
+		budget := NewErrorBudget(Config{errorWindowMaxErrors: 2, errorWindowDuration: time.Minute * 10, errorWindowIterations: 3})
+		assert.False(t, budget.record(now.Add(-time.Minute*30), true))
+		assert.False(t, budget.record(now.Add(-time.Minute*15), true))
+		assert.True(t, budget.record(now, true))
+		assert.Equal(t, "error budget: 3/2 errors in last 3 iterations", budget.describe(now))
+
+		// 3 errors within 10 minutes, but not in the last 3 iterations: duration window is exceeded
+		budget = NewErrorBudget(Config{errorWindowMaxErrors: 2, errorWindowDuration: time.Minute * 10, errorWindowIterations: 3})
+		assert.False(t, budget.record(now.Add(-time.Minute*5), true))
+		assert.False(t, budget.record(now.Add(-time.Minute*4), true))
+		assert.False(t, budget.record(now.Add(-time.Minute*3), false))
+		assert.False(t, budget.record(now.Add(-time.Minute*2), false))
+		assert.True(t, budget.record(now, true))
+		assert.Equal(t, "error budget: 3/2 errors in last 5 iterations within 10m0s", budget.describe(now))
+
+		// outcomes outside of both windows are dropped
+		errorCount, iterations := budget.usage(now.Add(time.Minute * 20))
+		assert.Equal(t, 1, errorCount)
+		assert.Equal(t, 3, iterations)
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		assert.False(t, NewErrorBudget(Config{}).enabled())
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileInode - inode is not available, replacement is detected only when file appears
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileLockSupported - without flock storage is not protected from second instance and leader election is not available
+const fileLockSupported = false
+
+func lockFile(file *os.File, wait bool) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const fileLockSupported = true
+
+// lockFile takes exclusive advisory lock, without wait it returns FileLockedError when file is locked by another process
+func lockFile(file *os.File, wait bool) error {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	err := syscall.Flock(int(file.Fd()), how)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return FileLockedError
+	}
+
+	return err
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
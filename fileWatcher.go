@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const FileWatchModeInotify = "inotify"
+const FileWatchModePolling = "polling"
+
+// InotifyPollInterval - low-frequency polling alongside inotify catches missed events, e.g. on network volume
+const InotifyPollInterval = time.Minute
+
+// watchChanges starts notifications about replacement (file is created or moved in) and in-place modification of file,
+// watch error is sent to stopped when notifications stop
+type watchChanges func(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error)
+
+// FileWatcher triggers DB check when database file (.fdb) is replaced and then stops changing for settleTime.
+// In-place modifications only postpone pending check: live DB file is written on every transaction,
+// including own checks of the watcher, so they would trigger checks forever.
+// It uses inotify with low-frequency polling of file inode, modification time and size alongside,
+// and falls back to polling every pollInterval when inotify is not available (e.g. on other OS) or stops.
+// Scheduled checks of the main loop stay as fallback, e.g. for file overwritten in place.
+type FileWatcher struct {
+	out                 io.Writer
+	file                string
+	settleTime          time.Duration
+	pollInterval        time.Duration
+	inotifyPollInterval time.Duration
+	watch               watchChanges
+	trigger             *IterationTrigger
+
+	stop chan struct{}
+	done chan struct{}
+
+	mutex         sync.Mutex
+	mode          string
+	changes       int
+	triggers      int
+	lastChangeAt  time.Time
+	lastTriggerAt time.Time
+}
+
+type fileWatchStatus struct {
+	File          string
+	Mode          string
+	Changes       int
+	Triggers      int
+	LastChangeAt  time.Time `json:",omitempty"`
+	LastTriggerAt time.Time `json:",omitempty"`
+}
+
+// fileSnapshot - polled file attributes, zero value for not existing file
+type fileSnapshot struct {
+	inode   uint64
+	modTime time.Time
+	size    int64
+}
+
+// NewFileWatcher returns nil when SECONDARY_DEKANAT_DB_FILE is not configured
+func NewFileWatcher(out io.Writer, config Config, trigger *IterationTrigger) *FileWatcher {
+	if config.secondaryDekanatDbFile == "" {
+		return nil
+	}
+
+	return &FileWatcher{
+		out:                 out,
+		file:                config.secondaryDekanatDbFile,
+		settleTime:          config.secondaryDekanatDbFileSettleTime,
+		pollInterval:        config.secondaryDekanatDbFilePollInterval,
+		inotifyPollInterval: max(InotifyPollInterval, config.secondaryDekanatDbFilePollInterval),
+		watch:               watchFileChanges,
+		trigger:             trigger,
+		stop:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+}
+
+func (watcher *FileWatcher) start() {
+	go watcher.run()
+}
+
+func (watcher *FileWatcher) close() {
+	close(watcher.stop)
+	<-watcher.done
+}
+
+func (watcher *FileWatcher) run() {
+	defer close(watcher.done)
+
+	replaced := make(chan struct{}, 1)
+	modified := make(chan struct{}, 1)
+	// buffered: reader of closed inotify could stop after run returns
+	stopped := make(chan error, 1)
+
+	poll := time.NewTicker(watcher.inotifyPollInterval)
+	defer poll.Stop()
+
+	closer, err := watcher.watch(watcher.file, replaced, modified, stopped)
+	if err == nil {
+		defer closer.Close()
+		watcher.setMode(FileWatchModeInotify)
+	} else {
+		watcher.fallBackToPolling(poll, err)
+		stopped = nil
+	}
+
+	settle := time.NewTimer(watcher.settleTime)
+	settle.Stop()
+	defer settle.Stop()
+
+	// pending - file is replaced, check waits until it stops changing
+	pending := false
+	snapshot := takeFileSnapshot(watcher.file)
+	for {
+		select {
+		case <-watcher.stop:
+			return
+
+		case <-replaced:
+			// change is already noticed, polling should not count it again
+			snapshot = takeFileSnapshot(watcher.file)
+			pending = true
+			watcher.changed(settle)
+
+		case <-modified:
+			snapshot = takeFileSnapshot(watcher.file)
+			if pending {
+				watcher.changed(settle)
+			}
+
+		case err = <-stopped:
+			watcher.fallBackToPolling(poll, err)
+			stopped = nil
+
+		case <-poll.C:
+			current := takeFileSnapshot(watcher.file)
+			if current != snapshot {
+				pending = pending || current.replaces(snapshot)
+				snapshot = current
+				if pending {
+					watcher.changed(settle)
+				}
+			}
+
+		case <-settle.C:
+			pending = false
+			fmt.Fprintln(watcher.out, getCurrentDatetime()+" database file is not changed for "+watcher.settleTime.String()+", run check")
+			watcher.mutex.Lock()
+			watcher.triggers++
+			watcher.lastTriggerAt = time.Now()
+			watcher.mutex.Unlock()
+			watcher.trigger.fire(TriggerSourceFileWatch)
+		}
+	}
+}
+
+func (watcher *FileWatcher) fallBackToPolling(poll *time.Ticker, err error) {
+	fmt.Fprintln(watcher.out, getCurrentDatetime()+" File watch falls back to polling every "+watcher.pollInterval.String()+": "+err.Error())
+	poll.Reset(watcher.pollInterval)
+	watcher.setMode(FileWatchModePolling)
+}
+
+// changed postpones check until the file stops changing
+func (watcher *FileWatcher) changed(settle *time.Timer) {
+	watcher.mutex.Lock()
+	watcher.changes++
+	watcher.lastChangeAt = time.Now()
+	watcher.mutex.Unlock()
+
+	settle.Reset(watcher.settleTime)
+}
+
+func (watcher *FileWatcher) setMode(mode string) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	watcher.mode = mode
+}
+
+func (watcher *FileWatcher) status() interface{} {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	return fileWatchStatus{
+		File:          watcher.file,
+		Mode:          watcher.mode,
+		Changes:       watcher.changes,
+		Triggers:      watcher.triggers,
+		LastChangeAt:  watcher.lastChangeAt,
+		LastTriggerAt: watcher.lastTriggerAt,
+	}
+}
+
+func takeFileSnapshot(file string) fileSnapshot {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileSnapshot{}
+	}
+
+	return fileSnapshot{inode: fileInode(info), modTime: info.ModTime(), size: info.Size()}
+}
+
+// replaces - file appeared or got new inode, other changes are in-place modifications
+func (snapshot fileSnapshot) replaces(previous fileSnapshot) bool {
+	return snapshot != fileSnapshot{} && (previous == fileSnapshot{} || snapshot.inode != previous.inode)
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyFileReplaceMask - IN_CLOSE_WRITE is not replacement: Firebird closes live DB file, e.g. after own check
+const inotifyFileReplaceMask = syscall.IN_CREATE | syscall.IN_MOVED_TO
+
+const inotifyFileChangeMask = inotifyFileReplaceMask | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB
+
+// watchFileChanges notifies about inotify events of the file. Parent directory is watched,
+// because restore may replace the file instead of writing it in place.
+func watchFileChanges(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.New("inotify init: " + err.Error())
+	}
+
+	_, err = syscall.InotifyAddWatch(fd, filepath.Dir(file), inotifyFileChangeMask)
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, errors.New("inotify watch " + filepath.Dir(file) + ": " + err.Error())
+	}
+
+	// non-blocking descriptor is handled by runtime poller, so Close interrupts Read
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		stopped <- readInotifyEvents(inotify, filepath.Base(file), replaced, modified)
+	}()
+
+	return inotify, nil
+}
+
+// readInotifyEvents returns error when inotify can not be read anymore, e.g. after Close
+func readInotifyEvents(inotify *os.File, name string, replaced chan<- struct{}, modified chan<- struct{}) error {
+	buffer := make([]byte, (syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)*16)
+	for {
+		size, err := inotify.Read(buffer)
+		if err != nil {
+			return errors.New("inotify read: " + err.Error())
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			eventName := string(buffer[nameStart:offset])
+			for len(eventName) > 0 && eventName[len(eventName)-1] == 0 {
+				eventName = eventName[:len(eventName)-1]
+			}
+
+			if eventName != name {
+				continue
+			}
+
+			changes := modified
+			if event.Mask&inotifyFileReplaceMask != 0 {
+				changes = replaced
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"runtime"
+)
+
+// watchFileChanges - inotify is available only on Linux, file watcher uses polling
+func watchFileChanges(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error) {
+	return nil, errors.New("inotify is not supported on " + runtime.GOOS)
+}
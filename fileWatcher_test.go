@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	waitWakeup := func(t *testing.T, trigger *IterationTrigger) {
+		select {
+		case <-trigger.wakeup:
+		case <-time.After(time.Second * 2):
+			assert.Fail(t, "file watcher did not trigger check")
+		}
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewFileWatcher(&bytes.Buffer{}, Config{}, NewIterationTrigger()))
+	})
+
+	t.Run("Check after file stops changing", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "dekanat.fdb")
+		trigger := NewIterationTrigger()
+		out := &bytes.Buffer{}
+
+		watcher := NewFileWatcher(out, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 100,
+			secondaryDekanatDbFilePollInterval: time.Hour,
+		}, trigger)
+		watcher.start()
+		time.Sleep(time.Millisecond * 20)
+
+		_ = os.WriteFile(file, []byte("restored"), 0600)
+		_ = os.WriteFile(filepath.Join(filepath.Dir(file), "other.txt"), []byte("other"), 0600)
+		waitWakeup(t, trigger)
+		watcher.close()
+
+		status := watcher.status().(fileWatchStatus)
+		assert.Equal(t, FileWatchModeInotify, status.Mode)
+		assert.Equal(t, 1, status.Triggers)
+		assert.Equal(t, TriggerSourceFileWatch, trigger.takeSource())
+		assert.Contains(t, out.String(), "database file is not changed for 100ms, run check")
+	})
+
+	t.Run("Polling fallback", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "not-mounted-yet")
+		file := filepath.Join(dir, "dekanat.fdb")
+		trigger := NewIterationTrigger()
+		out := &bytes.Buffer{}
+
+		watcher := NewFileWatcher(out, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 50,
+			secondaryDekanatDbFilePollInterval: time.Millisecond * 20,
+		}, trigger)
+		watcher.start()
+		time.Sleep(time.Millisecond * 30)
+
+		_ = os.Mkdir(dir, 0700)
+		_ = os.WriteFile(file, []byte("restored"), 0600)
+		waitWakeup(t, trigger)
+		watcher.close()
+
+		status := watcher.status().(fileWatchStatus)
+		assert.Equal(t, FileWatchModePolling, status.Mode)
+		assert.GreaterOrEqual(t, status.Changes, 1)
+		assert.Contains(t, out.String(), "File watch falls back to polling every 20ms")
+	})
+
+	t.Run("Polling alongside inotify", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "dekanat.fdb")
+		trigger := NewIterationTrigger()
+
+		watcher := NewFileWatcher(&bytes.Buffer{}, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 50,
+			secondaryDekanatDbFilePollInterval: time.Hour,
+		}, trigger)
+		assert.Equal(t, time.Hour, watcher.inotifyPollInterval)
+
+		// inotify misses events, e.g. of file changed on network volume
+		watcher.inotifyPollInterval = time.Millisecond * 20
+		watcher.watch = func(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error) {
+			return io.NopCloser(nil), nil
+		}
+		watcher.start()
+		time.Sleep(time.Millisecond * 30)
+
+		_ = os.WriteFile(file, []byte("restored"), 0600)
+		waitWakeup(t, trigger)
+		watcher.close()
+
+		status := watcher.status().(fileWatchStatus)
+		assert.Equal(t, FileWatchModeInotify, status.Mode)
+		assert.Equal(t, 1, status.Triggers)
+	})
+
+	t.Run("Polling after inotify stops", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "dekanat.fdb")
+		trigger := NewIterationTrigger()
+		out := &bytes.Buffer{}
+
+		watcher := NewFileWatcher(out, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 50,
+			secondaryDekanatDbFilePollInterval: time.Millisecond * 20,
+		}, trigger)
+		watcher.watch = func(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error) {
+			stopped <- errors.New("inotify read: bad file descriptor")
+			return io.NopCloser(nil), nil
+		}
+		watcher.start()
+		time.Sleep(time.Millisecond * 30)
+
+		_ = os.WriteFile(file, []byte("restored"), 0600)
+		waitWakeup(t, trigger)
+		watcher.close()
+
+		status := watcher.status().(fileWatchStatus)
+		assert.Equal(t, FileWatchModePolling, status.Mode)
+		assert.Contains(t, out.String(), "File watch falls back to polling every 20ms: inotify read: bad file descriptor")
+	})
+
+	t.Run("In-place modification does not trigger check", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "dekanat.fdb")
+		_ = os.WriteFile(file, []byte("live database"), 0600)
+		trigger := NewIterationTrigger()
+
+		watcher := NewFileWatcher(&bytes.Buffer{}, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 30,
+			secondaryDekanatDbFilePollInterval: time.Hour,
+		}, trigger)
+		// both inotify events and polling see the modification
+		watcher.inotifyPollInterval = time.Millisecond * 10
+		watcher.start()
+		time.Sleep(time.Millisecond * 20)
+
+		// page writes of transactions, e.g. of own DB check
+		handle, err := os.OpenFile(file, os.O_WRONLY, 0600)
+		assert.NoError(t, err)
+		_, _ = handle.WriteAt([]byte("header page"), 0)
+		_, _ = handle.Write([]byte("data page"))
+		_ = handle.Close()
+
+		select {
+		case <-trigger.wakeup:
+			assert.Fail(t, "in-place modification triggered check")
+		case <-time.After(time.Millisecond * 150):
+		}
+		watcher.close()
+
+		status := watcher.status().(fileWatchStatus)
+		assert.Equal(t, FileWatchModeInotify, status.Mode)
+		assert.Equal(t, 0, status.Triggers)
+	})
+
+	t.Run("Replaced file triggers check", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "dekanat.fdb")
+		_ = os.WriteFile(file, []byte("old database"), 0600)
+		trigger := NewIterationTrigger()
+
+		watcher := NewFileWatcher(&bytes.Buffer{}, Config{
+			secondaryDekanatDbFile:             file,
+			secondaryDekanatDbFileSettleTime:   time.Millisecond * 30,
+			secondaryDekanatDbFilePollInterval: time.Millisecond * 10,
+		}, trigger)
+		// inotify is not available, replacement is found by polling of inode
+		watcher.watch = func(file string, replaced chan<- struct{}, modified chan<- struct{}, stopped chan<- error) (io.Closer, error) {
+			return nil, errors.New("inotify is not supported")
+		}
+		watcher.start()
+		time.Sleep(time.Millisecond * 20)
+
+		// restored to temporary file, then renamed
+		_ = os.WriteFile(file+".tmp", []byte("new database"), 0600)
+		_ = os.Rename(file+".tmp", file)
+		waitWakeup(t, trigger)
+		watcher.close()
+
+		assert.Equal(t, 1, watcher.status().(fileWatchStatus).Triggers)
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/kneu-messenger-pigeon/fileStorage"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var NotLeaderError = errors.New("leadership is lost")
+
+type leaderLease struct {
+	Holder    string
+	RenewedAt time.Time
+	ExpiresAt time.Time
+}
+
+// LeaderElection keeps lease in lock file on shared storage. Only lease holder runs DB checks,
+// standby replica takes over when the lease is not renewed during leaseDuration.
+// Leader also holds storage lock, which is taken after the lease and released when leadership is lost.
+type LeaderElection struct {
+	out           io.Writer
+	leaseFile     string
+	leaseDuration time.Duration
+	identity      string
+	storageFile   string
+
+	mutex       sync.Mutex
+	lease       leaderLease
+	err         error
+	leading     bool
+	storageLock *StorageLock
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type leaderElectionStatus struct {
+	Identity       string
+	IsLeader       bool
+	Leader         string
+	LeaseExpiresAt time.Time
+	Error          string `json:",omitempty"`
+}
+
+func NewLeaderElection(out io.Writer, config Config) *LeaderElection {
+	return &LeaderElection{
+		out:           out,
+		leaseFile:     config.leaderElectionLeaseFile,
+		leaseDuration: config.leaderElectionLeaseDuration,
+		identity:      config.leaderElectionIdentity,
+		storageFile:   config.storageFile,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// start acquires lease before the first iteration and then renews it in background
+func (election *LeaderElection) start() {
+	election.tryAcquire(time.Now())
+	go election.run()
+}
+
+// close releases own lease, so standby replica takes over without waiting for lease expiration
+func (election *LeaderElection) close() {
+	close(election.stop)
+	<-election.done
+}
+
+func (election *LeaderElection) run() {
+	defer close(election.done)
+
+	ticker := time.NewTicker(election.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			election.tryAcquire(time.Now())
+		case <-election.stop:
+			election.release()
+			return
+		}
+	}
+}
+
+func (election *LeaderElection) tryAcquire(now time.Time) bool {
+	lease, err := election.updateLease(func(lease leaderLease) (leaderLease, bool) {
+		if lease.Holder != election.identity && now.Before(lease.ExpiresAt) {
+			return lease, false
+		}
+
+		return leaderLease{
+			Holder:    election.identity,
+			RenewedAt: now,
+			ExpiresAt: now.Add(election.leaseDuration),
+		}, true
+	})
+
+	election.mutex.Lock()
+	election.err = err
+	if err == nil {
+		election.lease = lease
+	}
+	isLeader := election.lease.Holder == election.identity && now.Before(election.lease.ExpiresAt)
+	storageErr := election.updateStorageLock(isLeader)
+	isLeader = isLeader && election.storageLock != nil
+	wasLeader := election.leading
+	election.leading = isLeader
+	election.mutex.Unlock()
+
+	if err != nil {
+		fmt.Fprintln(election.out, getCurrentDatetime()+" Leader election error: "+err.Error())
+	} else if storageErr != nil {
+		fmt.Fprintln(election.out, getCurrentDatetime()+" Lease is acquired, wait for storage lock: "+storageErr.Error())
+	} else if isLeader && !wasLeader {
+		fmt.Fprintln(election.out, getCurrentDatetime()+" Became leader: "+election.identity)
+	} else if !isLeader && wasLeader {
+		fmt.Fprintln(election.out, getCurrentDatetime()+" Lost leadership, current leader: "+lease.Holder)
+	}
+
+	return isLeader
+}
+
+func (election *LeaderElection) release() {
+	_, err := election.updateLease(func(lease leaderLease) (leaderLease, bool) {
+		if lease.Holder != election.identity {
+			return lease, false
+		}
+
+		lease.ExpiresAt = time.Time{}
+		return lease, true
+	})
+
+	election.mutex.Lock()
+	election.lease.ExpiresAt = time.Time{}
+	election.leading = false
+	_ = election.updateStorageLock(false)
+	election.mutex.Unlock()
+
+	if err != nil {
+		fmt.Fprintln(election.out, getCurrentDatetime()+" Failed to release leader lease: "+err.Error())
+	}
+}
+
+// updateStorageLock takes storage lock for lease holder and releases it for standby. Old leader keeps storage
+// locked until it notices lost lease, so new leader waits for it. Called with locked mutex.
+func (election *LeaderElection) updateStorageLock(holdsLease bool) error {
+	if !holdsLease {
+		if election.storageLock != nil {
+			election.storageLock.unlock()
+			election.storageLock = nil
+		}
+		return nil
+	}
+
+	if election.storageLock != nil {
+		return nil
+	}
+
+	storageLock, err := lockStorage(election.storageFile)
+	if err != nil {
+		return err
+	}
+
+	election.storageLock = storageLock
+	return nil
+}
+
+// isLeader is false after own lease expiration, even if renew failed because of storage error
+func (election *LeaderElection) isLeader(now time.Time) bool {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+
+	return election.lease.Holder == election.identity && now.Before(election.lease.ExpiresAt) && election.storageLock != nil
+}
+
+func (election *LeaderElection) status() interface{} {
+	election.mutex.Lock()
+	lease := election.lease
+	err := election.err
+	election.mutex.Unlock()
+
+	status := leaderElectionStatus{
+		Identity:       election.identity,
+		IsLeader:       election.isLeader(time.Now()),
+		Leader:         lease.Holder,
+		LeaseExpiresAt: lease.ExpiresAt,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// updateLease reads and writes lease file under exclusive flock, so replicas never overwrite each other
+func (election *LeaderElection) updateLease(update func(lease leaderLease) (leaderLease, bool)) (leaderLease, error) {
+	file, err := os.OpenFile(election.leaseFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return leaderLease{}, err
+	}
+	defer file.Close()
+
+	err = lockFile(file, true)
+	if err != nil {
+		return leaderLease{}, errors.New("failed to lock lease file: " + err.Error())
+	}
+	defer unlockFile(file)
+
+	var lease leaderLease
+	content, err := io.ReadAll(file)
+	if err == nil && len(content) != 0 {
+		err = json.Unmarshal(content, &lease)
+	}
+	if err != nil {
+		return leaderLease{}, errors.New("failed to read lease file: " + err.Error())
+	}
+
+	lease, changed := update(lease)
+	if !changed {
+		return lease, nil
+	}
+
+	content, _ = json.Marshal(lease)
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt(content, 0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return leaderLease{}, errors.New("failed to write lease file: " + err.Error())
+	}
+
+	return lease, nil
+}
+
+// leaderFencedStorage refuses to write state when leadership is lost during iteration, e.g. lease renewal failed
+// while iteration waited for DB, so old leader does not overwrite state of the new one
+type leaderFencedStorage struct {
+	fileStorage.Interface
+	election *LeaderElection
+}
+
+func (storage leaderFencedStorage) Set(data []byte) error {
+	if !storage.election.isLeader(time.Now()) {
+		return fmt.Errorf("%w: state is not saved", NotLeaderError)
+	}
+
+	return storage.Interface.Set(data)
+}
+
+func (storage leaderFencedStorage) setCandidate(data []byte) error {
+	if !storage.election.isLeader(time.Now()) {
+		return fmt.Errorf("%w: candidate is not saved", NotLeaderError)
+	}
+
+	return saveCandidate(storage.Interface, data)
+}
+
+// restore is not fenced: it rolls back own write after refused or failed announcement
+func (storage leaderFencedStorage) restore(data []byte) error {
+	return restoreStorage(storage.Interface, data)
+}
+
+// leaderFencedEventbus refuses to send events when leadership is lost during iteration,
+// so old leader and the new one do not announce the same load
+type leaderFencedEventbus struct {
+	MetaEventbusInterface
+	election *LeaderElection
+}
+
+func (eventbus leaderFencedEventbus) fence(eventName string) error {
+	if !eventbus.election.isLeader(time.Now()) {
+		return fmt.Errorf("%w: %s is not sent", NotLeaderError, eventName)
+	}
+
+	return nil
+}
+
+func (eventbus leaderFencedEventbus) sendSecondaryDbLoadedEvent(
+	currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int, details loadDetails,
+) error {
+	err := eventbus.fence(events.SecondaryDbLoadedEventName)
+	if err != nil {
+		return err
+	}
+
+	return eventbus.MetaEventbusInterface.sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime, previousDatabaseStateDatetime, year, details)
+}
+
+func (eventbus leaderFencedEventbus) sendCurrentYearEvent(year int, transition stateTransition) error {
+	err := eventbus.fence(events.CurrentYearEventName)
+	if err != nil {
+		return err
+	}
+
+	return eventbus.MetaEventbusInterface.sendCurrentYearEvent(year, transition)
+}
+
+func (eventbus leaderFencedEventbus) sendReplicationLagExceededEvent(event ReplicationLagExceededEvent) error {
+	err := eventbus.fence(ReplicationLagExceededEventName)
+	if err != nil {
+		return err
+	}
+
+	return eventbus.MetaEventbusInterface.sendReplicationLagExceededEvent(event)
+}
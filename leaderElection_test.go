@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	fileStorageMocks "github.com/kneu-messenger-pigeon/fileStorage/mocks"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestLeaderElection - replicas of one test share the storage file next to the lease file
+func newTestLeaderElection(out *bytes.Buffer, leaseFile string, identity string) *LeaderElection {
+	return NewLeaderElection(out, Config{
+		storageFile:                 leaseFile + ".storage",
+		leaderElectionLeaseFile:     leaseFile,
+		leaderElectionLeaseDuration: time.Minute,
+		leaderElectionIdentity:      identity,
+	})
+}
+
+func TestLeaderElection(t *testing.T) {
+	leaseFile := t.TempDir() + "/secondary-db-watcher-lease.json"
+
+	t.Run("Only one leader", func(t *testing.T) {
+		_ = os.Remove(leaseFile)
+		out := &bytes.Buffer{}
+		now := time.Now()
+
+		first := newTestLeaderElection(out, leaseFile, "first")
+		second := newTestLeaderElection(out, leaseFile, "second")
+
+		assert.True(t, first.tryAcquire(now))
+		assert.False(t, second.tryAcquire(now))
+		assert.True(t, first.tryAcquire(now.Add(time.Second*30)), "leader should renew own lease")
+		assert.False(t, second.tryAcquire(now.Add(time.Second*80)), "lease was renewed")
+
+		status := second.status().(leaderElectionStatus)
+		assert.Equal(t, "first", status.Leader)
+		assert.False(t, status.IsLeader)
+		assert.Contains(t, out.String(), "Became leader: first")
+		first.release()
+	})
+
+	t.Run("Standby takes over expired lease", func(t *testing.T) {
+		_ = os.Remove(leaseFile)
+		out := &bytes.Buffer{}
+		now := time.Now()
+
+		first := newTestLeaderElection(out, leaseFile, "first")
+		second := newTestLeaderElection(out, leaseFile, "second")
+
+		assert.True(t, first.tryAcquire(now))
+		assert.False(t, second.tryAcquire(now.Add(time.Second*59)))
+		assert.False(t, second.tryAcquire(now.Add(time.Second*61)), "storage is still locked by old leader")
+		assert.False(t, first.tryAcquire(now.Add(time.Second*62)))
+		assert.True(t, second.tryAcquire(now.Add(time.Second*63)))
+
+		assert.Contains(t, out.String(), "Lease is acquired, wait for storage lock: "+StorageLockedError.Error())
+		assert.Contains(t, out.String(), "Lost leadership, current leader: second")
+		assert.Contains(t, out.String(), "Became leader: second")
+		second.release()
+	})
+
+	t.Run("Standby replica runs with locked storage", func(t *testing.T) {
+		_ = os.Remove(leaseFile)
+		out := &bytes.Buffer{}
+
+		first := newTestLeaderElection(out, leaseFile, "first")
+		second := newTestLeaderElection(out, leaseFile, "second")
+		first.start()
+		second.start()
+
+		assert.True(t, first.isLeader(time.Now()))
+		assert.False(t, second.isLeader(time.Now()))
+		_, err := lockStorage(leaseFile + ".storage")
+		assert.ErrorIs(t, err, StorageLockedError, "leader holds storage lock")
+
+		first.close()
+		assert.True(t, second.tryAcquire(time.Now()))
+		second.close()
+
+		storageLock, err := lockStorage(leaseFile + ".storage")
+		assert.NoError(t, err, "storage lock is released with leadership")
+		storageLock.unlock()
+	})
+
+	t.Run("Release lease on close", func(t *testing.T) {
+		_ = os.Remove(leaseFile)
+		out := &bytes.Buffer{}
+
+		first := newTestLeaderElection(out, leaseFile, "first")
+		second := newTestLeaderElection(out, leaseFile, "second")
+
+		first.start()
+		assert.True(t, first.isLeader(time.Now()))
+		assert.False(t, second.tryAcquire(time.Now()))
+
+		first.close()
+		assert.False(t, first.isLeader(time.Now()))
+		assert.True(t, second.tryAcquire(time.Now()))
+		second.release()
+	})
+
+	t.Run("Lease file error", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		election := newTestLeaderElection(out, os.TempDir(), "first")
+
+		assert.False(t, election.tryAcquire(time.Now()))
+		assert.Contains(t, out.String(), "Leader election error")
+		assert.NotEmpty(t, election.status().(leaderElectionStatus).Error)
+	})
+
+	t.Run("Fenced storage and eventbus after lost leadership", func(t *testing.T) {
+		_ = os.Remove(leaseFile)
+		election := newTestLeaderElection(&bytes.Buffer{}, leaseFile, "first")
+		storage := fileStorageMocks.NewInterface(t)
+		eventbus := NewMockMetaEventbusInterface(t)
+
+		fencedStorage := leaderFencedStorage{Interface: storage, election: election}
+		fencedEventbus := leaderFencedEventbus{MetaEventbusInterface: eventbus, election: election}
+
+		storage.On("Set", []byte("state")).Return(nil).Once()
+		eventbus.On("sendCurrentYearEvent", 2023, stateTransition{}).Return(nil).Once()
+
+		assert.True(t, election.tryAcquire(time.Now()))
+		assert.NoError(t, fencedStorage.Set([]byte("state")))
+		assert.NoError(t, fencedEventbus.sendCurrentYearEvent(2023, stateTransition{}))
+
+		// lease is not renewed, e.g. shared storage is unavailable during long iteration
+		election.lease.ExpiresAt = time.Now().Add(-time.Second)
+
+		assert.ErrorIs(t, fencedStorage.Set([]byte("state")), NotLeaderError)
+		assert.ErrorIs(t, saveCandidate(fencedStorage, []byte("candidate")), NotLeaderError)
+		assert.ErrorIs(t, fencedEventbus.sendCurrentYearEvent(2023, stateTransition{}), NotLeaderError)
+		assert.ErrorIs(t, fencedEventbus.sendSecondaryDbLoadedEvent(time.Now(), time.Now(), 2023, loadDetails{}), NotLeaderError)
+		assert.ErrorIs(t, fencedEventbus.sendReplicationLagExceededEvent(ReplicationLagExceededEvent{}), NotLeaderError)
+		election.release()
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,14 +13,32 @@ import (
 
 var BreakLoopError = errors.New("break loop")
 var TooManyError = errors.New("too many error")
+var PermanentError = errors.New("permanent error")
 
-func runMainLoop(config Config, out io.Writer, iterationExecutor func() error) error {
+const ErrorCategoryDatabase = "database"
+const ErrorCategoryStorage = "storage"
+const ErrorCategoryEventbus = "eventbus"
+const ErrorCategoryOther = "other"
+
+// runMainLoop runs iterations with pause between them. Trigger (may be nil) or SIGUSR1 starts next iteration
+// before pause ends, SIGUSR2 logs dump (may be nil) with consecutive error counts.
+func runMainLoop(
+	config Config, out io.Writer, errorBudget *ErrorBudget,
+	trigger *IterationTrigger, dump func() string, iterationExecutor func() error,
+) error {
 	var err error
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// buffer keeps SIGINT/SIGTERM when SIGUSR* are received during iteration
+	sig := make(chan os.Signal, 4)
+	signal.Notify(sig, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}, userSignals...)...)
 	defer signal.Stop(sig)
 
-	errorCount := 0
+	var wakeup <-chan struct{}
+	if trigger != nil {
+		wakeup = trigger.wakeup
+	}
+
+	iterationExecutor = guardIteration(out, config.iterationTimeout, iterationExecutor)
+	errorCounts := map[string]int{}
 	var pause time.Duration
 	for {
 		err = iterationExecutor()
@@ -33,29 +52,115 @@ func runMainLoop(config Config, out io.Writer, iterationExecutor func() error) e
 			pause = config.pauseAfterError
 			fmt.Fprintln(out, getCurrentDatetime()+" "+err.Error())
 
-			errorCount++
-			if errorCount >= config.errorCountToBreak {
-				fmt.Fprintln(out, "Too many mistakes: "+err.Error())
-				err = TooManyError
+			if isPermanentError(err) {
+				fmt.Fprintln(out, "Permanent error, retry will not help: "+err.Error())
+				err = fmt.Errorf("%w: %w", PermanentError, err)
 				break
 			}
 
+			if errorBudget.enabled() {
+				exceeded := errorBudget.record(time.Now(), true)
+				fmt.Fprintln(out, getCurrentDatetime()+" "+errorBudget.describe(time.Now()))
+				if exceeded {
+					fmt.Fprintln(out, "Too many mistakes, "+errorBudget.describe(time.Now())+": "+err.Error())
+					err = fmt.Errorf("%w: %w", TooManyError, err)
+					break
+				}
+			} else {
+				category := getErrorCategory(err)
+				errorCounts[category]++
+				if errorCounts[category] >= config.getErrorCountToBreak(category) {
+					fmt.Fprintln(out, "Too many mistakes ("+category+"): "+err.Error())
+					err = fmt.Errorf("%w: %w", TooManyError, err)
+					break
+				}
+			}
+
 		} else {
 			fmt.Fprintln(out, getCurrentDatetime()+" iteration done success")
-			errorCount = 0
+			clear(errorCounts)
+			if errorBudget.enabled() {
+				errorBudget.record(time.Now(), false)
+			}
 		}
 
-		select {
-		case <-time.After(pause): // nothing
-		case <-sig:
+		if !waitNextIteration(out, pause, wakeup, sig, trigger, func() string {
+			return dumpMainLoop(dump, errorCounts)
+		}) {
 			fmt.Fprintln(out, "cancelled")
 			return nil
+		}
+	}
+
+	return err
+}
+
+// waitNextIteration returns false when main loop is cancelled by signal
+func waitNextIteration(
+	out io.Writer, pause time.Duration, wakeup <-chan struct{}, sig <-chan os.Signal,
+	trigger *IterationTrigger, dump func() string,
+) bool {
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+
+		case <-wakeup:
+			return true
 
+		case received := <-sig:
+			switch received {
+			case checkSignal:
+				fmt.Fprintln(out, getCurrentDatetime()+" SIGUSR1 received, run check immediately")
+				if trigger == nil {
+					return true
+				}
+				// wakes up through trigger, so detection metrics count checks by signal
+				trigger.fire(TriggerSourceSignal)
+
+			case dumpSignal:
+				fmt.Fprintln(out, getCurrentDatetime()+" SIGUSR2 received, dump: "+dump())
+
+			default:
+				return false
+			}
 		}
+	}
+}
 
+func dumpMainLoop(dump func() string, errorCounts map[string]int) string {
+	counts, _ := json.Marshal(errorCounts)
+	description := "consecutive errors " + string(counts)
+	if dump != nil {
+		description += ", " + dump()
 	}
 
-	return err
+	return description
+}
+
+// isPermanentError - wrong DB credentials or schema will not be fixed by retry
+func isPermanentError(err error) bool {
+	return errors.Is(err, DbSchemaMismatchError) || errors.Is(err, DbAccessDeniedError) || errors.Is(err, ConfigInvalidError)
+}
+
+// getErrorCategory - transient errors of each category have separate budget
+func getErrorCategory(err error) string {
+	if errors.Is(err, DbUnreachableError) {
+		return ErrorCategoryDatabase
+	}
+
+	if errors.Is(err, StorageUnreadableError) {
+		return ErrorCategoryStorage
+	}
+
+	if errors.Is(err, KafkaUnreachableError) {
+		return ErrorCategoryEventbus
+	}
+
+	return ErrorCategoryOther
 }
 
 func getCurrentDatetime() string {
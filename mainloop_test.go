@@ -32,7 +32,7 @@ func TestMainLoop(t *testing.T) {
 		}
 
 		var out bytes.Buffer
-		err := runMainLoop(config, &out, executeIteration)
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
 		output := out.String()
 
 		assert.Contains(t, output, "iteration done success", "output not contains iteration done success")
@@ -69,7 +69,7 @@ func TestMainLoop(t *testing.T) {
 		}
 
 		var out bytes.Buffer
-		err := runMainLoop(config, &out, executeIteration)
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
 
 		output := out.String()
 
@@ -82,6 +82,7 @@ func TestMainLoop(t *testing.T) {
 			t, err, TooManyError,
 			"Expected forTooManyError, got %d.", err,
 		)
+		assert.Equal(t, "too many error: dummy error", err.Error(), "TooManyError should wrap the last error")
 
 		assert.Contains(t, output, "dummy error", "No dummy error in output")
 
@@ -94,6 +95,91 @@ func TestMainLoop(t *testing.T) {
 		assert.Contains(t, output, "Too many mistakes", "No Too many mistakes in output")
 	})
 
+	t.Run("PermanentErrorBreaksImmediately", func(t *testing.T) {
+		config := Config{
+			pauseAfterSuccess: 0,
+			pauseAfterError:   0,
+			errorCountToBreak: 3,
+		}
+
+		functionExecutedCount := 0
+		executeIteration := func() error {
+			functionExecutedCount++
+			if functionExecutedCount >= 5 {
+				return BreakLoopError
+			}
+			return classifyError(DbSchemaMismatchError, errors.New("Table unknown TSESS_LOG"))
+		}
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
+
+		assert.Equal(t, 1, functionExecutedCount)
+		assert.ErrorIs(t, err, PermanentError)
+		assert.ErrorIs(t, err, DbSchemaMismatchError)
+		assert.Contains(t, out.String(), "Permanent error, retry will not help: Table unknown TSESS_LOG")
+	})
+
+	t.Run("SeparateBudgetsByCategory", func(t *testing.T) {
+		config := Config{
+			pauseAfterSuccess: 0,
+			pauseAfterError:   0,
+			errorCountToBreak: 2,
+			errorCountToBreakByCategory: map[string]int{
+				ErrorCategoryEventbus: 4,
+			},
+		}
+
+		kafkaErr := classifyError(KafkaUnreachableError, errors.New("leader not available"))
+		dbErr := classifyError(DbUnreachableError, errors.New("connection refused"))
+		iterationErrors := []error{kafkaErr, dbErr, kafkaErr, nil, kafkaErr, kafkaErr, kafkaErr, kafkaErr, BreakLoopError}
+
+		functionExecutedCount := 0
+		executeIteration := func() error {
+			err := iterationErrors[functionExecutedCount]
+			functionExecutedCount++
+			return err
+		}
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
+
+		assert.Equal(t, 8, functionExecutedCount)
+		assert.ErrorIs(t, err, TooManyError)
+		assert.ErrorIs(t, err, KafkaUnreachableError)
+		assert.Contains(t, out.String(), "Too many mistakes (eventbus): leader not available")
+	})
+
+	t.Run("FlappingErrorsTripWindowedBudget", func(t *testing.T) {
+		config := Config{
+			pauseAfterSuccess:     0,
+			pauseAfterError:       0,
+			errorCountToBreak:     3,
+			errorWindowMaxErrors:  2,
+			errorWindowIterations: 10,
+		}
+
+		functionExecutedCount := 0
+		executeIteration := func() error {
+			functionExecutedCount++
+			if functionExecutedCount >= 10 {
+				return BreakLoopError
+			}
+			if functionExecutedCount%2 == 1 {
+				return errors.New("dummy error")
+			}
+			return nil
+		}
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
+
+		assert.Equal(t, 5, functionExecutedCount)
+		assert.ErrorIs(t, err, TooManyError)
+		assert.Contains(t, out.String(), "error budget: 1/2 errors in last 1 iterations")
+		assert.Contains(t, out.String(), "Too many mistakes, error budget: 3/2 errors in last 5 iterations: dummy error")
+	})
+
 	t.Run("PauseOnSuccess", func(t *testing.T) {
 		config := Config{
 			secondaryDekanatDbDSN: "dummy",
@@ -118,7 +204,7 @@ func TestMainLoop(t *testing.T) {
 		var out bytes.Buffer
 
 		start := time.Now()
-		err := runMainLoop(config, &out, executeIteration)
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
 		executionTime := time.Since(start)
 
 		assert.Equalf(
@@ -160,7 +246,7 @@ func TestMainLoop(t *testing.T) {
 		var out bytes.Buffer
 
 		start := time.Now()
-		err := runMainLoop(config, &out, executeIteration)
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
 
 		executionTime := time.Since(start)
 
@@ -180,6 +266,87 @@ func TestMainLoop(t *testing.T) {
 		)
 	})
 
+	t.Run("WakeupBeforePauseEnds", func(t *testing.T) {
+		config := Config{
+			pauseAfterSuccess: time.Hour,
+			errorCountToBreak: 3,
+		}
+
+		trigger := NewIterationTrigger()
+		functionExecutedCount := 0
+		executeIteration := func() error {
+			functionExecutedCount++
+			if functionExecutedCount >= 3 {
+				return BreakLoopError
+			}
+			trigger.fire(TriggerSourceDbEvent)
+			return nil
+		}
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), trigger, nil, executeIteration)
+
+		assert.ErrorIs(t, err, BreakLoopError)
+		assert.Equal(t, 3, functionExecutedCount)
+	})
+
+	t.Run("Sigusr1WakesUpBeforePauseEnds", func(t *testing.T) {
+		config := Config{
+			pauseAfterSuccess: time.Hour,
+			errorCountToBreak: 3,
+		}
+
+		trigger := NewIterationTrigger()
+		functionExecutedCount := 0
+		executeIteration := func() error {
+			functionExecutedCount++
+			if functionExecutedCount >= 2 {
+				return BreakLoopError
+			}
+			return nil
+		}
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		}()
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), trigger, nil, executeIteration)
+
+		assert.ErrorIs(t, err, BreakLoopError)
+		assert.Equal(t, 2, functionExecutedCount)
+		assert.Contains(t, out.String(), "SIGUSR1 received, run check immediately")
+		assert.Equal(t, TriggerSourceSignal, trigger.takeSource())
+	})
+
+	t.Run("Sigusr2Dump", func(t *testing.T) {
+		config := Config{
+			pauseAfterError:   time.Hour,
+			errorCountToBreak: 3,
+		}
+
+		executeIteration := func() error {
+			return classifyError(DbUnreachableError, errors.New("connection refused"))
+		}
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+			time.Sleep(time.Millisecond * 50)
+			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+		}()
+
+		var out bytes.Buffer
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, func() string {
+			return `{"detection":{}}`
+		}, executeIteration)
+
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), `SIGUSR2 received, dump: consecutive errors {"database":1}, {"detection":{}}`)
+		assert.Contains(t, out.String(), "cancelled")
+	})
+
 	t.Run("Sigterm", func(t *testing.T) {
 		config := Config{
 			secondaryDekanatDbDSN: "dummy",
@@ -208,7 +375,7 @@ func TestMainLoop(t *testing.T) {
 			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 		}()
 
-		err := runMainLoop(config, &out, executeIteration)
+		err := runMainLoop(config, &out, NewErrorBudget(config), nil, nil, executeIteration)
 
 		assert.Equalf(
 			t, expectedExecutedCount, functionExecutedCount,
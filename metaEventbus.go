@@ -11,27 +11,63 @@ import (
 	"time"
 )
 
+const ReplicationLagExceededEventName = "ReplicationLagExceededEvent"
+
+// ReplicationLagExceededEvent - secondary DB is behind primary DB more than REPLICATION_LAG_THRESHOLD
+type ReplicationLagExceededEvent struct {
+	PrimaryDatabaseDatetime   time.Time
+	SecondaryDatabaseDatetime time.Time
+	LagSeconds                int64
+	ThresholdSeconds          int64
+}
+
 type MetaEventbusInterface interface {
-	sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int) error
-	sendCurrentYearEvent(year int) error
+	sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int, details loadDetails) error
+	sendCurrentYearEvent(year int, transition stateTransition) error
+	sendReplicationLagExceededEvent(event ReplicationLagExceededEvent) error
 }
 
 type MetaEventbus struct {
-	writer events.WriterInterface
-	out    io.Writer
+	writer  events.WriterInterface
+	out     io.Writer
+	headers []kafka.Header
+	// audit - optional audit log of announcements
+	audit *AuditLog
 }
 
-func (metaEventbus MetaEventbus) writeMessage(eventName string, event interface{}) error {
+func (metaEventbus MetaEventbus) makeMessage(eventName string, event interface{}, headers ...kafka.Header) kafka.Message {
 	payload, _ := json.Marshal(event)
-	return metaEventbus.writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(eventName),
-			Value: payload,
-		},
-	)
+	return kafka.Message{
+		Key:     []byte(eventName),
+		Value:   payload,
+		Headers: append(metaEventbus.headers[:len(metaEventbus.headers):len(metaEventbus.headers)], headers...),
+	}
+}
+
+func (metaEventbus MetaEventbus) writeMessage(eventName string, event interface{}, headers ...kafka.Header) error {
+	return metaEventbus.writer.WriteMessages(context.Background(), metaEventbus.makeMessage(eventName, event, headers...))
 }
 
-func (metaEventbus MetaEventbus) sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int) error {
+// writeAuditedMessage writes audit record with delivery result. Event is already sent (or failed),
+// so failed audit record is only logged: returned error would cause repeated announcement.
+func (metaEventbus MetaEventbus) writeAuditedMessage(
+	transition stateTransition, eventName string, event interface{}, headers ...kafka.Header,
+) error {
+	message := metaEventbus.makeMessage(eventName, event, headers...)
+	err := metaEventbus.writer.WriteMessages(context.Background(), message)
+
+	if metaEventbus.audit != nil {
+		auditErr := metaEventbus.audit.record(message, transition, err)
+		if auditErr != nil {
+			fmt.Fprintln(metaEventbus.out, getCurrentDatetime()+" Failed to write audit record: "+auditErr.Error())
+		}
+	}
+
+	return err
+}
+
+// sendSecondaryDbLoadedEvent - event payload is shared with consumers, so load details are sent in headers
+func (metaEventbus MetaEventbus) sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int, details loadDetails) error {
 	if previousDatabaseStateDatetime.IsZero() {
 		previousDatabaseStateDatetime = time.Date(
 			year, 8, 1,
@@ -40,16 +76,48 @@ func (metaEventbus MetaEventbus) sendSecondaryDbLoadedEvent(currentDatabaseState
 	}
 
 	fmt.Fprintln(metaEventbus.out, "send SecondaryDbLoadedEvent ", currentDatabaseStateDatetime.Format(time.RFC3339))
-	return metaEventbus.writeMessage(events.SecondaryDbLoadedEventName, events.SecondaryDbLoadedEvent{
+	return metaEventbus.writeAuditedMessage(details.Transition, events.SecondaryDbLoadedEventName, events.SecondaryDbLoadedEvent{
 		CurrentSecondaryDatabaseDatetime:  currentDatabaseStateDatetime,
 		PreviousSecondaryDatabaseDatetime: previousDatabaseStateDatetime,
 		Year:                              year,
-	})
+	}, loadDetailsHeaders(details)...)
 }
 
-func (metaEventbus MetaEventbus) sendCurrentYearEvent(year int) error {
+func loadDetailsHeaders(details loadDetails) []kafka.Header {
+	var headers []kafka.Header
+	if details.Sessions.Count != 0 {
+		headers = append(headers,
+			kafka.Header{Key: "sessionCount", Value: []byte(strconv.Itoa(details.Sessions.Count))},
+			kafka.Header{Key: "firstSessionAt", Value: []byte(details.Sessions.FirstDatetime.Format(time.RFC3339))},
+			kafka.Header{Key: "lastSessionAt", Value: []byte(details.Sessions.LastDatetime.Format(time.RFC3339))},
+		)
+	}
+
+	if !details.Identity.isZero() {
+		headers = append(headers,
+			kafka.Header{Key: "databaseCreatedAt", Value: []byte(details.Identity.CreationDate.Format(time.RFC3339))},
+			kafka.Header{Key: "databaseOdsVersion", Value: []byte(details.Identity.OdsVersion)},
+		)
+		if details.Identity.Guid != "" {
+			headers = append(headers, kafka.Header{Key: "databaseGuid", Value: []byte(details.Identity.Guid)})
+		}
+	}
+
+	if details.FullReload {
+		headers = append(headers, kafka.Header{Key: "fullReload", Value: []byte("true")})
+	}
+
+	return headers
+}
+
+func (metaEventbus MetaEventbus) sendCurrentYearEvent(year int, transition stateTransition) error {
 	fmt.Fprintln(metaEventbus.out, "send sendCurrentYearEvent ", strconv.Itoa(year))
-	return metaEventbus.writeMessage(events.CurrentYearEventName, events.CurrentYearEvent{
+	return metaEventbus.writeAuditedMessage(transition, events.CurrentYearEventName, events.CurrentYearEvent{
 		Year: year,
 	})
 }
+
+func (metaEventbus MetaEventbus) sendReplicationLagExceededEvent(event ReplicationLagExceededEvent) error {
+	fmt.Fprintln(metaEventbus.out, "send ReplicationLagExceededEvent ", time.Duration(event.LagSeconds)*time.Second)
+	return metaEventbus.writeMessage(ReplicationLagExceededEventName, event)
+}
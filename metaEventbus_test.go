@@ -41,7 +41,7 @@ func TestSendSecondaryDbLoadedEvent(t *testing.T) {
 			writer: writer,
 			out:    out,
 		}
-		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year())
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year(), loadDetails{})
 
 		assert.NoErrorf(t, err, "Not expect for error")
 		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
@@ -70,7 +70,7 @@ func TestSendSecondaryDbLoadedEvent(t *testing.T) {
 			writer: writer,
 			out:    out,
 		}
-		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, time.Time{}, currentDatetime.Year())
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, time.Time{}, currentDatetime.Year(), loadDetails{})
 
 		assert.NoErrorf(t, err, "Not expect for error")
 		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
@@ -78,6 +78,73 @@ func TestSendSecondaryDbLoadedEvent(t *testing.T) {
 		assert.Contains(t, out.String(), "send SecondaryDbLoadedEvent")
 	})
 
+	t.Run("Send with headers", func(t *testing.T) {
+		headers := []kafka.Header{{Key: ReplayHeader, Value: []byte("true")}}
+		expected := expectedMessage
+		expected.Headers = headers
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), expected).Return(nil)
+
+		eventbus := MetaEventbus{
+			writer:  writer,
+			out:     &bytes.Buffer{},
+			headers: headers,
+		}
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year(), loadDetails{})
+
+		assert.NoErrorf(t, err, "Not expect for error")
+		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
+	})
+
+	t.Run("Send with sessions", func(t *testing.T) {
+		expected := expectedMessage
+		expected.Headers = []kafka.Header{
+			{Key: ReplayHeader, Value: []byte("true")},
+			{Key: "sessionCount", Value: []byte("2")},
+			{Key: "firstSessionAt", Value: []byte(previousDatetime.Format(time.RFC3339))},
+			{Key: "lastSessionAt", Value: []byte(currentDatetime.Format(time.RFC3339))},
+		}
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), expected).Return(nil)
+
+		eventbus := MetaEventbus{
+			writer:  writer,
+			out:     &bytes.Buffer{},
+			headers: []kafka.Header{{Key: ReplayHeader, Value: []byte("true")}},
+		}
+		details := loadDetails{Sessions: loadSessions{Count: 2, FirstDatetime: previousDatetime, LastDatetime: currentDatetime}}
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year(), details)
+
+		assert.NoErrorf(t, err, "Not expect for error")
+		assert.Len(t, eventbus.headers, 1, "eventbus headers should not be changed")
+	})
+
+	t.Run("Send with database identity", func(t *testing.T) {
+		identity := dbIdentity{CreationDate: previousDatetime, Guid: "{A}", OdsVersion: "13.0"}
+
+		expected := expectedMessage
+		expected.Headers = []kafka.Header{
+			{Key: "databaseCreatedAt", Value: []byte(previousDatetime.Format(time.RFC3339))},
+			{Key: "databaseOdsVersion", Value: []byte("13.0")},
+			{Key: "databaseGuid", Value: []byte("{A}")},
+			{Key: "fullReload", Value: []byte("true")},
+		}
+
+		writer := mocks.NewWriterInterface(t)
+		writer.On("WriteMessages", context.Background(), expected).Return(nil)
+
+		eventbus := MetaEventbus{
+			writer: writer,
+			out:    &bytes.Buffer{},
+		}
+		details := loadDetails{Identity: identity, FullReload: true}
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year(), details)
+
+		assert.NoErrorf(t, err, "Not expect for error")
+	})
+
 	t.Run("Failed send", func(t *testing.T) {
 		writer := mocks.NewWriterInterface(t)
 		writer.On("WriteMessages", context.Background(), expectedMessage).Return(expectedError)
@@ -86,7 +153,7 @@ func TestSendSecondaryDbLoadedEvent(t *testing.T) {
 			writer: writer,
 			out:    &bytes.Buffer{},
 		}
-		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year())
+		err := eventbus.sendSecondaryDbLoadedEvent(currentDatetime, previousDatetime, currentDatetime.Year(), loadDetails{})
 
 		assert.Errorf(t, err, "Expect for error")
 		assert.Equal(t, expectedError, err, "Got unexpected error")
@@ -117,7 +184,7 @@ func TestSendCurrentYearEvent(t *testing.T) {
 			out:    out,
 		}
 
-		err := eventbus.sendCurrentYearEvent(expectedYear)
+		err := eventbus.sendCurrentYearEvent(expectedYear, stateTransition{})
 
 		assert.NoErrorf(t, err, "Not expect for error")
 		writer.AssertNumberOfCalls(t, "WriteMessages", 1)
@@ -134,7 +201,7 @@ func TestSendCurrentYearEvent(t *testing.T) {
 			writer: writer,
 			out:    out,
 		}
-		err := eventbus.sendCurrentYearEvent(expectedYear)
+		err := eventbus.sendCurrentYearEvent(expectedYear, stateTransition{})
 
 		assert.Errorf(t, err, "Expect for error")
 		assert.Equal(t, expectedError, err, "Got unexpected error")
@@ -142,3 +209,31 @@ func TestSendCurrentYearEvent(t *testing.T) {
 		assert.Contains(t, out.String(), "send sendCurrentYearEvent")
 	})
 }
+
+func TestSendReplicationLagExceededEvent(t *testing.T) {
+	event := ReplicationLagExceededEvent{
+		PrimaryDatabaseDatetime:   time.Date(2023, 9, 3, 4, 0, 0, 0, time.Local),
+		SecondaryDatabaseDatetime: time.Date(2023, 9, 1, 4, 0, 0, 0, time.Local),
+		LagSeconds:                172800,
+		ThresholdSeconds:          86400,
+	}
+
+	payload, _ := json.Marshal(event)
+	expectedMessage := kafka.Message{
+		Key:   []byte(ReplicationLagExceededEventName),
+		Value: payload,
+	}
+
+	writer := mocks.NewWriterInterface(t)
+	writer.On("WriteMessages", context.Background(), expectedMessage).Return(nil)
+
+	out := &bytes.Buffer{}
+	eventbus := MetaEventbus{
+		writer: writer,
+		out:    out,
+	}
+	err := eventbus.sendReplicationLagExceededEvent(event)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "send ReplicationLagExceededEvent  48h0m0s")
+}
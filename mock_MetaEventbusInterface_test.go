@@ -13,13 +13,13 @@ type MockMetaEventbusInterface struct {
 	mock.Mock
 }
 
-// sendCurrentYearEvent provides a mock function with given fields: year
-func (_m *MockMetaEventbusInterface) sendCurrentYearEvent(year int) error {
-	ret := _m.Called(year)
+// sendCurrentYearEvent provides a mock function with given fields: year, transition
+func (_m *MockMetaEventbusInterface) sendCurrentYearEvent(year int, transition stateTransition) error {
+	ret := _m.Called(year, transition)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(int) error); ok {
-		r0 = rf(year)
+	if rf, ok := ret.Get(0).(func(int, stateTransition) error); ok {
+		r0 = rf(year, transition)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -27,13 +27,27 @@ func (_m *MockMetaEventbusInterface) sendCurrentYearEvent(year int) error {
 	return r0
 }
 
-// sendSecondaryDbLoadedEvent provides a mock function with given fields: currentDatabaseStateDatetime, previousDatabaseStateDatetime, year
-func (_m *MockMetaEventbusInterface) sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int) error {
-	ret := _m.Called(currentDatabaseStateDatetime, previousDatabaseStateDatetime, year)
+// sendReplicationLagExceededEvent provides a mock function with given fields: event
+func (_m *MockMetaEventbusInterface) sendReplicationLagExceededEvent(event ReplicationLagExceededEvent) error {
+	ret := _m.Called(event)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(time.Time, time.Time, int) error); ok {
-		r0 = rf(currentDatabaseStateDatetime, previousDatabaseStateDatetime, year)
+	if rf, ok := ret.Get(0).(func(ReplicationLagExceededEvent) error); ok {
+		r0 = rf(event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// sendSecondaryDbLoadedEvent provides a mock function with given fields: currentDatabaseStateDatetime, previousDatabaseStateDatetime, year, details
+func (_m *MockMetaEventbusInterface) sendSecondaryDbLoadedEvent(currentDatabaseStateDatetime time.Time, previousDatabaseStateDatetime time.Time, year int, details loadDetails) error {
+	ret := _m.Called(currentDatabaseStateDatetime, previousDatabaseStateDatetime, year, details)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(time.Time, time.Time, int, loadDetails) error); ok {
+		r0 = rf(currentDatabaseStateDatetime, previousDatabaseStateDatetime, year, details)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// LoadAnnouncedError is not a failure: it is returned by one-shot run to exit with ExitCodeLoadAnnounced
+var LoadAnnouncedError = errors.New("new load announced")
+
+const OnceResultError = "error"
+
+// onceSummary - machine-readable result of one-shot run, the only output to stdout
+type onceSummary struct {
+	Result        string
+	Error         string `json:",omitempty"`
+	PreviousState dbState
+	CurrentState  dbState
+	FinishedAt    time.Time
+}
+
+// runOnce writes logs to out and summary to summaryOut. Check is guarded like main loop iteration:
+// panic is recovered and hung check is abandoned after timeout.
+func runOnce(out io.Writer, summaryOut io.Writer, timeout time.Duration, checkIteration func() (checkResult, error)) error {
+	var guardedResult checkResult
+	err := guardIteration(out, timeout, func() error {
+		var err error
+		guardedResult, err = checkIteration()
+		return err
+	})()
+
+	// abandoned check could still write its result
+	var result checkResult
+	if !errors.Is(err, IterationHungError) {
+		result = guardedResult
+	}
+
+	summary := onceSummary{
+		Result:        result.Status,
+		PreviousState: result.PreviousState,
+		CurrentState:  result.CurrentState,
+		FinishedAt:    time.Now(),
+	}
+	if err != nil {
+		summary.Result = OnceResultError
+		summary.Error = err.Error()
+	}
+
+	_ = json.NewEncoder(summaryOut).Encode(summary)
+
+	if err != nil {
+		return err
+	}
+
+	if result.Status == CheckResultAnnounced {
+		return LoadAnnouncedError
+	}
+
+	return nil
+}
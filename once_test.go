@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	previousState := dbState{
+		ActualDatetime: time.Date(2023, 9, 11, 4, 0, 0, 0, time.Local),
+		EducationYear:  2023,
+	}
+	currentState := dbState{
+		ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, time.Local),
+		EducationYear:  2023,
+	}
+
+	readSummary := func(t *testing.T, out *bytes.Buffer) onceSummary {
+		var summary onceSummary
+		err := json.Unmarshal(out.Bytes(), &summary)
+		assert.NoErrorf(t, err, "summary is not valid JSON: %s", out.String())
+		return summary
+	}
+
+	t.Run("Load announced", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runOnce(&bytes.Buffer{}, &out, 0, func() (checkResult, error) {
+			return checkResult{Status: CheckResultAnnounced, PreviousState: previousState, CurrentState: currentState}, nil
+		})
+
+		assert.ErrorIs(t, err, LoadAnnouncedError)
+		summary := readSummary(t, &out)
+		assert.Equal(t, CheckResultAnnounced, summary.Result)
+		assert.True(t, currentState.isEqual(summary.CurrentState))
+		assert.True(t, previousState.isEqual(summary.PreviousState))
+	})
+
+	t.Run("No change", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runOnce(&bytes.Buffer{}, &out, 0, func() (checkResult, error) {
+			return checkResult{Status: CheckResultUnchanged, PreviousState: previousState, CurrentState: previousState}, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, CheckResultUnchanged, readSummary(t, &out).Result)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var out bytes.Buffer
+		expectedError := errors.New("dummy error")
+		err := runOnce(&bytes.Buffer{}, &out, 0, func() (checkResult, error) {
+			return checkResult{}, expectedError
+		})
+
+		assert.ErrorIs(t, err, expectedError)
+		summary := readSummary(t, &out)
+		assert.Equal(t, OnceResultError, summary.Result)
+		assert.Equal(t, "dummy error", summary.Error)
+	})
+
+	t.Run("Panic is recovered", func(t *testing.T) {
+		var out, logs bytes.Buffer
+		err := runOnce(&logs, &out, 0, func() (checkResult, error) {
+			panic("dummy panic")
+		})
+
+		assert.ErrorIs(t, err, IterationPanicError)
+		assert.Equal(t, OnceResultError, readSummary(t, &out).Result)
+		assert.Contains(t, logs.String(), "Iteration panic: dummy panic")
+	})
+
+	t.Run("Hung check is abandoned after timeout", func(t *testing.T) {
+		var out bytes.Buffer
+		release := make(chan struct{})
+		defer close(release)
+
+		err := runOnce(&bytes.Buffer{}, &out, time.Millisecond*10, func() (checkResult, error) {
+			<-release
+			return checkResult{Status: CheckResultAnnounced}, nil
+		})
+
+		assert.ErrorIs(t, err, IterationHungError)
+		summary := readSummary(t, &out)
+		assert.Equal(t, OnceResultError, summary.Result)
+		assert.Contains(t, summary.Error, "iteration abandoned")
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const ReadOnlyCheckRefuse = "refuse"
+const ReadOnlyCheckWarn = "warn"
+const ReadOnlyCheckOff = "off"
+
+const GetCurrentUserQuery = "SELECT CURRENT_USER, CURRENT_ROLE FROM RDB$DATABASE"
+
+// GetWritePrivilegesQuery - tables with INSERT, UPDATE or DELETE privilege granted to user, role or PUBLIC
+const GetWritePrivilegesQuery = "SELECT DISTINCT TRIM(RDB$RELATION_NAME) FROM RDB$USER_PRIVILEGES " +
+	"WHERE RDB$USER IN (?, ?, 'PUBLIC') AND RDB$OBJECT_TYPE = 0 AND RDB$PRIVILEGE IN ('I', 'U', 'D') " +
+	"AND RDB$RELATION_NAME NOT STARTING WITH 'RDB$' AND RDB$RELATION_NAME NOT STARTING WITH 'MON$' " +
+	"AND RDB$RELATION_NAME NOT STARTING WITH 'SEC$' ORDER BY 1"
+
+// administrators have write access without explicit privileges
+var adminUsers = []string{"SYSDBA"}
+var adminRoles = []string{"RDB$ADMIN"}
+
+// ReadOnlyGuard checks once that secondary DB credentials can not write to Dekanat DB.
+// Check is repeated on every iteration until DB is reachable, so it does not block start with unavailable DB.
+type ReadOnlyGuard struct {
+	out      io.Writer
+	config   Config
+	mode     string
+	verified bool
+}
+
+type writeAccess struct {
+	User   string
+	Role   string
+	Tables []string
+}
+
+// NewReadOnlyGuard returns nil when READ_ONLY_CHECK is off
+func NewReadOnlyGuard(out io.Writer, config Config) *ReadOnlyGuard {
+	if config.readOnlyCheck == ReadOnlyCheckOff {
+		return nil
+	}
+
+	return &ReadOnlyGuard{
+		out:    out,
+		config: config,
+		mode:   config.readOnlyCheck,
+	}
+}
+
+// verify returns permanent error when write access is detected in refuse mode
+func (guard *ReadOnlyGuard) verify(secondaryDekanatDb *sql.DB) error {
+	if guard.verified {
+		return nil
+	}
+
+	access, err := getWriteAccess(secondaryDekanatDb)
+	if err != nil {
+		fmt.Fprintln(guard.out, getCurrentDatetime()+" WARNING: failed to check read-only access to secondary DB, retry on next iteration: "+
+			hideSecrets(err, guard.config).Error())
+		return nil
+	}
+
+	if !access.isWritable() {
+		guard.verified = true
+		fmt.Fprintln(guard.out, getCurrentDatetime()+" secondary DB user "+access.User+" is read-only")
+		return nil
+	}
+
+	if guard.mode == ReadOnlyCheckRefuse {
+		return classifyError(ConfigInvalidError, errors.New(
+			access.String()+", use read-only credentials or set READ_ONLY_CHECK="+ReadOnlyCheckWarn,
+		))
+	}
+
+	guard.verified = true
+	fmt.Fprintln(guard.out, getCurrentDatetime()+" WARNING: "+access.String()+", watcher continues because READ_ONLY_CHECK="+ReadOnlyCheckWarn)
+	return nil
+}
+
+func getWriteAccess(secondaryDekanatDb *sql.DB) (access writeAccess, err error) {
+	var role sql.NullString
+	err = secondaryDekanatDb.QueryRow(GetCurrentUserQuery).Scan(&access.User, &role)
+	if err != nil {
+		return access, err
+	}
+	access.User = strings.TrimSpace(access.User)
+	access.Role = strings.TrimSpace(role.String)
+
+	rows, err := secondaryDekanatDb.Query(GetWritePrivilegesQuery, access.User, access.Role)
+	if err != nil {
+		return access, err
+	}
+	defer rows.Close()
+
+	var table string
+	for rows.Next() {
+		err = rows.Scan(&table)
+		if err != nil {
+			return access, err
+		}
+		access.Tables = append(access.Tables, strings.TrimSpace(table))
+	}
+
+	return access, rows.Err()
+}
+
+func (access writeAccess) isAdmin() bool {
+	return containsFold(adminUsers, access.User) || containsFold(adminRoles, access.Role)
+}
+
+func (access writeAccess) isWritable() bool {
+	return access.isAdmin() || len(access.Tables) != 0
+}
+
+func (access writeAccess) String() string {
+	if access.isAdmin() {
+		return fmt.Sprintf("secondary DB user %s (role %q) is administrator with write access", access.User, access.Role)
+	}
+
+	return fmt.Sprintf("secondary DB user %s (role %q) has write access to tables: %s", access.User, access.Role, strings.Join(access.Tables, ", "))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func expectWriteAccess(mock sqlmock.Sqlmock, user string, role interface{}, tables ...string) {
+	mock.ExpectQuery(regexp.QuoteMeta(GetCurrentUserQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"CURRENT_USER", "CURRENT_ROLE"}).AddRow(user, role),
+	)
+
+	rows := sqlmock.NewRows([]string{"TRIM"})
+	for _, table := range tables {
+		rows.AddRow(table)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(GetWritePrivilegesQuery)).WillReturnRows(rows)
+}
+
+func TestReadOnlyGuard(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewReadOnlyGuard(&bytes.Buffer{}, Config{readOnlyCheck: ReadOnlyCheckOff}))
+	})
+
+	t.Run("Read-only user is verified once", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		expectWriteAccess(mock, "WATCHER ", nil)
+
+		out := &bytes.Buffer{}
+		guard := NewReadOnlyGuard(out, Config{readOnlyCheck: ReadOnlyCheckRefuse})
+
+		assert.NoError(t, guard.verify(db))
+		assert.NoError(t, guard.verify(db))
+		assert.Contains(t, out.String(), "secondary DB user WATCHER is read-only")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Refuse user with write privileges", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		expectWriteAccess(mock, "WATCHER", "", "T_PRJURN", "TSESS_LOG")
+
+		err := NewReadOnlyGuard(&bytes.Buffer{}, Config{readOnlyCheck: ReadOnlyCheckRefuse}).verify(db)
+
+		assert.ErrorIs(t, err, ConfigInvalidError)
+		assert.True(t, isPermanentError(err))
+		assert.Equal(t,
+			`secondary DB user WATCHER (role "") has write access to tables: T_PRJURN, TSESS_LOG, use read-only credentials or set READ_ONLY_CHECK=warn`,
+			err.Error(),
+		)
+	})
+
+	t.Run("Refuse administrator", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		expectWriteAccess(mock, "sysdba", "NONE")
+
+		err := NewReadOnlyGuard(&bytes.Buffer{}, Config{readOnlyCheck: ReadOnlyCheckRefuse}).verify(db)
+
+		assert.ErrorIs(t, err, ConfigInvalidError)
+		assert.Contains(t, err.Error(), "is administrator with write access")
+	})
+
+	t.Run("Warn about write privileges", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		expectWriteAccess(mock, "WATCHER", "RDB$ADMIN")
+
+		out := &bytes.Buffer{}
+		guard := NewReadOnlyGuard(out, Config{readOnlyCheck: ReadOnlyCheckWarn})
+
+		assert.NoError(t, guard.verify(db))
+		assert.NoError(t, guard.verify(db))
+		assert.Contains(t, out.String(), "WARNING: secondary DB user WATCHER (role \"RDB$ADMIN\") is administrator with write access")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Check is retried after DB error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetCurrentUserQuery)).WillReturnError(errors.New("connection refused for USER:SECRET@HOST/DB"))
+		expectWriteAccess(mock, "WATCHER", nil)
+
+		out := &bytes.Buffer{}
+		guard := NewReadOnlyGuard(out, Config{readOnlyCheck: ReadOnlyCheckRefuse, secondaryDekanatDbDSN: "USER:SECRET@HOST/DB"})
+
+		assert.NoError(t, guard.verify(db))
+		assert.Contains(t, out.String(), "WARNING: failed to check read-only access to secondary DB, retry on next iteration")
+		assert.NotContains(t, out.String(), "SECRET")
+
+		assert.NoError(t, guard.verify(db))
+		assert.Contains(t, out.String(), "secondary DB user WATCHER is read-only")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReplayHeader marks replayed events, so consumers could distinguish them from new loads
+const ReplayHeader = "replay"
+
+type replayEvent struct {
+	current  dbState
+	previous dbState
+}
+
+// runReplay re-publishes SecondaryDbLoadedEvent for past loads from state history or from -datetimes list
+func runReplay(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false, "print events instead of sending to Kafka")
+	from := flags.String("from", "", "replay loads since datetime, RFC3339")
+	to := flags.String("to", "", "replay loads till datetime, RFC3339")
+	datetimes := flags.String("datetimes", "", "comma separated load datetimes, RFC3339; state history is used when empty")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig(getEnvFilename())
+	if err != nil {
+		return errors.New("Failed to load config: " + err.Error())
+	}
+
+	var states []dbState
+	if *datetimes != "" {
+		states, err = parseReplayDatetimes(*datetimes)
+	} else {
+		states, err = readReplayStates(NewSafeStorage(out, config))
+	}
+	if err != nil {
+		return err
+	}
+
+	replayEvents, err := filterReplayEvents(makeReplayEvents(states), *from, *to)
+	if err != nil {
+		return err
+	}
+
+	// dry run does not emit events, so it is not audited
+	var audit *AuditLog
+	var writer events.WriterInterface = dryRunWriter{out: out}
+	if !*dryRun {
+		audit = NewAuditLog(config)
+		writer = newKafkaWriter(config, audit)
+	}
+	defer writer.Close()
+
+	eventbus := MetaEventbus{
+		out:     out,
+		writer:  writer,
+		headers: []kafka.Header{{Key: ReplayHeader, Value: []byte("true")}},
+		audit:   audit,
+	}
+
+	for _, event := range replayEvents {
+		err = eventbus.sendSecondaryDbLoadedEvent(
+			event.current.ActualDatetime, event.previous.ActualDatetime, event.current.EducationYear, loadDetails{
+				Identity:   event.current.Identity,
+				Transition: stateTransition{Before: event.previous, After: event.current},
+			},
+		)
+		if err != nil {
+			return errors.New("Failed to send Secondary DB loaded Event to Kafka: " + err.Error())
+		}
+	}
+
+	fmt.Fprintf(out, "replayed %d events\n", len(replayEvents))
+	return nil
+}
+
+func readReplayStates(storage *SafeStorage) ([]dbState, error) {
+	serialized, err := storage.Get()
+	if err != nil {
+		return nil, errors.New("Failed to load storage file: " + err.Error())
+	}
+
+	document, err := unmarshalStateDocument(serialized)
+	if err != nil {
+		return nil, errors.New("Failed to get DB state history from Storage: " + err.Error())
+	}
+
+	return document.announcedStates(), nil
+}
+
+func parseReplayDatetimes(datetimes string) ([]dbState, error) {
+	var states []dbState
+	for _, datetimeString := range strings.Split(datetimes, ",") {
+		datetime, err := time.Parse(StorageTimeFormat, strings.TrimSpace(datetimeString))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("wrong datetime %q: %s", datetimeString, err))
+		}
+
+		year, err := extractEducationYear(datetime)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, dbState{
+			ActualDatetime: datetime,
+			EducationYear:  year,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ActualDatetime.Before(states[j].ActualDatetime)
+	})
+
+	return states, nil
+}
+
+// makeReplayEvents - previous datetime of each event is the preceding load
+func makeReplayEvents(states []dbState) []replayEvent {
+	replayEvents := make([]replayEvent, len(states))
+	for i, state := range states {
+		replayEvents[i].current = state
+		if i > 0 {
+			replayEvents[i].previous = states[i-1]
+		}
+	}
+
+	return replayEvents
+}
+
+func filterReplayEvents(replayEvents []replayEvent, from string, to string) ([]replayEvent, error) {
+	var err error
+	var fromTime, toTime time.Time
+
+	if from != "" {
+		fromTime, err = time.Parse(StorageTimeFormat, from)
+	}
+	if err == nil && to != "" {
+		toTime, err = time.Parse(StorageTimeFormat, to)
+	}
+	if err != nil {
+		return nil, errors.New("wrong replay range: " + err.Error())
+	}
+
+	filtered := make([]replayEvent, 0, len(replayEvents))
+	for _, event := range replayEvents {
+		datetime := event.current.ActualDatetime
+		if (fromTime.IsZero() || !datetime.Before(fromTime)) && (toTime.IsZero() || !datetime.After(toTime)) {
+			filtered = append(filtered, event)
+		}
+	}
+
+	return filtered, nil
+}
+
+// dryRunWriter prints messages instead of sending to Kafka
+type dryRunWriter struct {
+	out io.Writer
+}
+
+func (writer dryRunWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	for _, message := range messages {
+		headers := make([]string, len(message.Headers))
+		for i, header := range message.Headers {
+			headers[i] = header.Key + "=" + string(header.Value)
+		}
+
+		fmt.Fprintf(writer.out, "dry run: %s [%s] %s\n", message.Key, strings.Join(headers, ","), message.Value)
+	}
+
+	return nil
+}
+
+func (writer dryRunWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/kneu-messenger-pigeon/events"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReplay(t *testing.T) {
+	loc := time.Local
+	storageFile := t.TempDir() + "/storage.json"
+
+	_ = os.Setenv("KAFKA_HOST", expectedConfig.kafkaHost)
+	_ = os.Setenv("SECONDARY_DEKANAT_DB_DSN", expectedConfig.secondaryDekanatDbDSN)
+	_ = os.Setenv("STORAGE_FILE", storageFile)
+	defer os.Setenv("STORAGE_FILE", expectedConfig.storageFile)
+
+	document := stateDocument{}
+	for day := 1; day <= 3; day++ {
+		document = document.next(dbState{
+			ActualDatetime: time.Date(2023, 9, day, 4, 0, 0, 0, loc),
+			EducationYear:  2023,
+		})
+	}
+	_ = NewSafeStorage(&bytes.Buffer{}, Config{storageFile: storageFile}).Set(document.marshal())
+
+	t.Run("Dry run from state history", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dry-run"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, strings.Count(output, "dry run: "+events.SecondaryDbLoadedEventName+" [replay=true]"))
+		assert.Contains(t, output, "replayed 3 events")
+		assert.Less(t, strings.Index(output, `"CurrentSecondaryDatabaseDatetime":"2023-09-01`), strings.Index(output, `"CurrentSecondaryDatabaseDatetime":"2023-09-02`))
+	})
+
+	t.Run("Dry run with range", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dry-run", "-from", "2023-09-02T00:00:00Z", "-to", "2023-09-02T23:00:00Z"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Contains(t, output, "replayed 1 events")
+		assert.Contains(t, output, `"PreviousSecondaryDatabaseDatetime":"2023-09-01`)
+	})
+
+	t.Run("Dry run with datetimes", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dry-run", "-datetimes", "2023-10-02T04:00:00Z, 2023-10-01T04:00:00Z"}, &out)
+		output := out.String()
+
+		assert.NoError(t, err)
+		assert.Contains(t, output, "replayed 2 events")
+		assert.Contains(t, output, `"CurrentSecondaryDatabaseDatetime":"2023-10-02T04:00:00Z","PreviousSecondaryDatabaseDatetime":"2023-10-01T04:00:00Z"`)
+	})
+
+	t.Run("Wrong datetimes", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dry-run", "-datetimes", "2023-10-02"}, &out)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "wrong datetime")
+	})
+
+	t.Run("Wrong range", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dry-run", "-from", "yesterday"}, &out)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "wrong replay range")
+	})
+
+	t.Run("Unknown flag", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runCommand([]string{"replay", "-dummy"}, &out)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestMakeReplayEvents(t *testing.T) {
+	states := []dbState{
+		{ActualDatetime: time.Date(2023, 9, 1, 4, 0, 0, 0, time.Local), EducationYear: 2023},
+		{ActualDatetime: time.Date(2023, 9, 2, 4, 0, 0, 0, time.Local), EducationYear: 2023},
+	}
+
+	replayEvents := makeReplayEvents(states)
+
+	assert.Len(t, replayEvents, 2)
+	assert.True(t, replayEvents[0].previous.ActualDatetime.IsZero())
+	assert.Equal(t, states[0], replayEvents[1].previous)
+	assert.Equal(t, states[1], replayEvents[1].current)
+}
+
+func TestDryRunWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer := dryRunWriter{out: &out}
+
+	err := writer.WriteMessages(context.Background(), kafka.Message{
+		Key:     []byte("key"),
+		Value:   []byte("value"),
+		Headers: []kafka.Header{{Key: "a", Value: []byte("1")}},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, "dry run: key [a=1] value\n", out.String())
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplicationLagMonitor compares last session datetime of primary DB with ActualDatetime of secondary DB.
+// ReplicationLagExceededEvent is sent once when lag exceeds threshold and again only after lag goes back below it.
+type ReplicationLagMonitor struct {
+	config    Config
+	primaryDb *sql.DB
+	threshold time.Duration
+
+	mutex             sync.Mutex
+	measured          bool
+	lag               time.Duration
+	primaryDatetime   time.Time
+	secondaryDatetime time.Time
+	measuredAt        time.Time
+	exceeded          bool
+	lastError         error
+}
+
+type replicationLagStatus struct {
+	Lag               string `json:",omitempty"`
+	LagSeconds        int64
+	PrimaryDatetime   time.Time `json:",omitempty"`
+	SecondaryDatetime time.Time `json:",omitempty"`
+	MeasuredAt        time.Time `json:",omitempty"`
+	Threshold         string    `json:",omitempty"`
+	Exceeded          bool
+	LastError         string `json:",omitempty"`
+}
+
+func NewReplicationLagMonitor(config Config, primaryDb *sql.DB) *ReplicationLagMonitor {
+	return &ReplicationLagMonitor{
+		config:    config,
+		primaryDb: primaryDb,
+		threshold: config.replicationLagThreshold,
+	}
+}
+
+// measure returns lag of secondary DB state, negative lag (primary is checked before secondary is loaded) is zero
+func (monitor *ReplicationLagMonitor) measure(secondary dbState, eventbus MetaEventbusInterface, now time.Time) (time.Duration, error) {
+	_, primaryDatetime, err := getLastSession(monitor.primaryDb)
+	if err != nil {
+		err = hideSecrets(classifyError(dbErrorClass(err), errors.New("failed to get last datetime from primary DB: "+err.Error())), monitor.config)
+		monitor.mutex.Lock()
+		monitor.lastError = err
+		monitor.mutex.Unlock()
+		return 0, err
+	}
+
+	lag := primaryDatetime.Sub(secondary.ActualDatetime)
+	if lag < 0 {
+		lag = 0
+	}
+
+	monitor.mutex.Lock()
+	monitor.measured = true
+	monitor.lag = lag
+	monitor.primaryDatetime = primaryDatetime
+	monitor.secondaryDatetime = secondary.ActualDatetime
+	monitor.measuredAt = now
+	monitor.lastError = nil
+	wasExceeded := monitor.exceeded
+	monitor.mutex.Unlock()
+
+	exceeded := monitor.threshold > 0 && lag > monitor.threshold
+	if exceeded && !wasExceeded {
+		err = eventbus.sendReplicationLagExceededEvent(ReplicationLagExceededEvent{
+			PrimaryDatabaseDatetime:   primaryDatetime,
+			SecondaryDatabaseDatetime: secondary.ActualDatetime,
+			LagSeconds:                int64(lag.Seconds()),
+			ThresholdSeconds:          int64(monitor.threshold.Seconds()),
+		})
+		if err != nil {
+			// event is retried on the next measurement
+			return lag, classifyError(KafkaUnreachableError, errors.New("Failed to send Replication lag exceeded Event to Kafka: "+err.Error()))
+		}
+	}
+
+	monitor.mutex.Lock()
+	monitor.exceeded = exceeded
+	monitor.mutex.Unlock()
+
+	return lag, nil
+}
+
+// lagSeconds - metric value, unknown until the first successful measurement
+func (monitor *ReplicationLagMonitor) lagSeconds() (float64, bool) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	return monitor.lag.Seconds(), monitor.measured
+}
+
+func (monitor *ReplicationLagMonitor) status() interface{} {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	status := replicationLagStatus{
+		LagSeconds:        int64(monitor.lag.Seconds()),
+		PrimaryDatetime:   monitor.primaryDatetime,
+		SecondaryDatetime: monitor.secondaryDatetime,
+		MeasuredAt:        monitor.measuredAt,
+		Exceeded:          monitor.exceeded,
+	}
+	if monitor.measured {
+		status.Lag = monitor.lag.String()
+	}
+	if monitor.threshold > 0 {
+		status.Threshold = monitor.threshold.String()
+	}
+	if monitor.lastError != nil {
+		status.LastError = monitor.lastError.Error()
+	}
+
+	return status
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestReplicationLagMonitor(t *testing.T) {
+	secondaryDatetime := time.Date(2023, 9, 1, 4, 0, 0, 0, time.Local)
+	secondary := dbState{ActualDatetime: secondaryDatetime}
+	config := Config{replicationLagThreshold: time.Hour * 24}
+
+	t.Run("Lag below threshold", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		dbMock.ExpectPing()
+		setQueryResult(dbMock, GetLastSessionQuery, secondaryDatetime.Add(time.Hour*5))
+
+		monitor := NewReplicationLagMonitor(config, db)
+		lag, err := monitor.measure(secondary, NewMockMetaEventbusInterface(t), time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour*5, lag)
+
+		lagSeconds, known := monitor.lagSeconds()
+		assert.True(t, known)
+		assert.Equal(t, float64(18000), lagSeconds)
+
+		status := monitor.status().(replicationLagStatus)
+		assert.Equal(t, "5h0m0s", status.Lag)
+		assert.Equal(t, "24h0m0s", status.Threshold)
+		assert.False(t, status.Exceeded)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("Event is sent once while lag exceeds threshold", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		primaryDatetime := secondaryDatetime.Add(time.Hour * 48)
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectPing()
+			setQueryResult(dbMock, GetLastSessionQuery, primaryDatetime)
+		}
+
+		eventbus := NewMockMetaEventbusInterface(t)
+		eventbus.On("sendReplicationLagExceededEvent", ReplicationLagExceededEvent{
+			PrimaryDatabaseDatetime:   primaryDatetime,
+			SecondaryDatabaseDatetime: secondaryDatetime,
+			LagSeconds:                172800,
+			ThresholdSeconds:          86400,
+		}).Return(nil).Once()
+
+		monitor := NewReplicationLagMonitor(config, db)
+		_, err := monitor.measure(secondary, eventbus, time.Now())
+		assert.NoError(t, err)
+
+		lag, err := monitor.measure(secondary, eventbus, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour*48, lag)
+		assert.True(t, monitor.status().(replicationLagStatus).Exceeded)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("Failed event is retried", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectPing()
+			setQueryResult(dbMock, GetLastSessionQuery, secondaryDatetime.Add(time.Hour*48))
+		}
+
+		eventbus := NewMockMetaEventbusInterface(t)
+		eventbus.On("sendReplicationLagExceededEvent", mock.Anything).Return(errors.New("kafka is down")).Once()
+		eventbus.On("sendReplicationLagExceededEvent", mock.Anything).Return(nil).Once()
+
+		monitor := NewReplicationLagMonitor(config, db)
+		_, err := monitor.measure(secondary, eventbus, time.Now())
+		assert.ErrorIs(t, err, KafkaUnreachableError)
+		assert.False(t, monitor.status().(replicationLagStatus).Exceeded)
+
+		_, err = monitor.measure(secondary, eventbus, time.Now())
+		assert.NoError(t, err)
+		assert.True(t, monitor.status().(replicationLagStatus).Exceeded)
+	})
+
+	t.Run("Secondary is ahead of primary", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		dbMock.ExpectPing()
+		setQueryResult(dbMock, GetLastSessionQuery, secondaryDatetime.Add(-time.Minute))
+
+		lag, err := NewReplicationLagMonitor(config, db).measure(secondary, NewMockMetaEventbusInterface(t), time.Now())
+
+		assert.NoError(t, err)
+		assert.Zero(t, lag)
+	})
+
+	t.Run("Primary DB error", func(t *testing.T) {
+		db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		dbMock.ExpectPing()
+		setQueryResult(dbMock, GetLastSessionQuery, errors.New("no permission for read access to TABLE TSESS_LOG"))
+
+		monitor := NewReplicationLagMonitor(config, db)
+		_, err := monitor.measure(secondary, NewMockMetaEventbusInterface(t), time.Now())
+
+		assert.ErrorIs(t, err, DbAccessDeniedError)
+		assert.Contains(t, err.Error(), "failed to get last datetime from primary DB")
+
+		_, known := monitor.lagSeconds()
+		assert.False(t, known)
+		assert.Contains(t, monitor.status().(replicationLagStatus).LastError, "no permission")
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const GetAttachmentsQuery = "SELECT MON$USER, MON$REMOTE_PROCESS FROM MON$ATTACHMENTS WHERE MON$ATTACHMENT_ID <> CURRENT_CONNECTION"
+
+const GetWriteTransactionsQuery = "SELECT MON$ATTACHMENT_ID, DATEDIFF(SECOND FROM MON$TIMESTAMP TO CURRENT_TIMESTAMP) " +
+	"FROM MON$TRANSACTIONS WHERE MON$ATTACHMENT_ID <> CURRENT_CONNECTION AND MON$READ_ONLY = 0"
+
+// GetMonitorPrivilegeQuery - without MONITOR_ANY_ATTACHMENT (Firebird 4+) non-admin user sees only own attachments in MON$ tables
+const GetMonitorPrivilegeQuery = "SELECT RDB$SYSTEM_PRIVILEGE(MONITOR_ANY_ATTACHMENT) FROM RDB$DATABASE"
+
+// RestoreDetector finds in-progress restore by Firebird monitoring tables: connection of loader user or process,
+// or write transaction older than writeTransactionAge. Announcement is deferred while restore is running.
+// Monitoring privilege is checked once before the first DB check, restore is not visible without it.
+type RestoreDetector struct {
+	out                 io.Writer
+	config              Config
+	loaderUsers         []string
+	loaderProcesses     []string
+	writeTransactionAge time.Duration
+	privilegeVerified   bool
+}
+
+type restoreActivity struct {
+	LoaderAttachments []string
+	LongTransactions  int
+}
+
+// NewRestoreDetector returns nil when neither loaders nor write transaction age are configured
+func NewRestoreDetector(out io.Writer, config Config) *RestoreDetector {
+	if len(config.restoreLoaderUsers) == 0 && len(config.restoreLoaderProcesses) == 0 && config.restoreWriteTransactionAge == 0 {
+		return nil
+	}
+
+	return &RestoreDetector{
+		out:                 out,
+		config:              config,
+		loaderUsers:         config.restoreLoaderUsers,
+		loaderProcesses:     config.restoreLoaderProcesses,
+		writeTransactionAge: config.restoreWriteTransactionAge,
+	}
+}
+
+// verifyPrivilege warns when MON$ tables do not show attachments of other users, e.g. loader,
+// check is repeated on next iteration when DB is not reachable
+func (detector *RestoreDetector) verifyPrivilege(secondaryDekanatDb *sql.DB) {
+	if detector.privilegeVerified {
+		return
+	}
+
+	var granted bool
+	err := secondaryDekanatDb.QueryRow(GetMonitorPrivilegeQuery).Scan(&granted)
+	if err != nil && dbErrorClass(err) == DbUnreachableError {
+		fmt.Fprintln(detector.out, getCurrentDatetime()+" WARNING: failed to check MONITOR_ANY_ATTACHMENT privilege, retry on next iteration: "+
+			hideSecrets(err, detector.config).Error())
+		return
+	}
+
+	detector.privilegeVerified = true
+	if err != nil {
+		fmt.Fprintln(detector.out, getCurrentDatetime()+" WARNING: failed to check MONITOR_ANY_ATTACHMENT privilege (Firebird 4+), "+
+			"restore detection sees other attachments only if secondary DB user is administrator: "+hideSecrets(err, detector.config).Error())
+		return
+	}
+
+	if !granted {
+		fmt.Fprintln(detector.out, getCurrentDatetime()+" WARNING: secondary DB user has no MONITOR_ANY_ATTACHMENT privilege, "+
+			"restore detection can not see loader connections and transactions, grant the privilege or use STABILITY_CHECKS instead")
+	}
+}
+
+func (detector *RestoreDetector) detect(secondaryDekanatDb *sql.DB) (activity restoreActivity, err error) {
+	if len(detector.loaderUsers) != 0 || len(detector.loaderProcesses) != 0 {
+		activity.LoaderAttachments, err = detector.findLoaderAttachments(secondaryDekanatDb)
+		if err != nil {
+			return activity, err
+		}
+	}
+
+	if detector.writeTransactionAge > 0 {
+		activity.LongTransactions, err = detector.countLongTransactions(secondaryDekanatDb)
+	}
+
+	return activity, err
+}
+
+func (detector *RestoreDetector) findLoaderAttachments(secondaryDekanatDb *sql.DB) ([]string, error) {
+	rows, err := secondaryDekanatDb.Query(GetAttachmentsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []string
+	var user, process sql.NullString
+	for rows.Next() {
+		err = rows.Scan(&user, &process)
+		if err != nil {
+			return nil, err
+		}
+
+		userName := strings.TrimSpace(user.String)
+		processName := processBaseName(process.String)
+		if containsFold(detector.loaderUsers, userName) || containsFold(detector.loaderProcesses, processName) {
+			attachments = append(attachments, userName+"@"+processName)
+		}
+	}
+
+	return attachments, rows.Err()
+}
+
+func (detector *RestoreDetector) countLongTransactions(secondaryDekanatDb *sql.DB) (int, error) {
+	rows, err := secondaryDekanatDb.Query(GetWriteTransactionsQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	var attachmentId, ageSeconds int64
+	for rows.Next() {
+		err = rows.Scan(&attachmentId, &ageSeconds)
+		if err != nil {
+			return 0, err
+		}
+
+		if time.Duration(ageSeconds)*time.Second >= detector.writeTransactionAge {
+			count++
+		}
+	}
+
+	return count, rows.Err()
+}
+
+func (activity restoreActivity) isRunning() bool {
+	return len(activity.LoaderAttachments) != 0 || activity.LongTransactions != 0
+}
+
+func (activity restoreActivity) String() string {
+	return fmt.Sprintf(
+		"loader connections: [%s], long write transactions: %d",
+		strings.Join(activity.LoaderAttachments, ", "), activity.LongTransactions,
+	)
+}
+
+// processBaseName - MON$REMOTE_PROCESS is full path of client executable, on Windows or Linux
+func processBaseName(process string) string {
+	process = strings.TrimSpace(process)
+	if index := strings.LastIndexAny(process, `/\`); index != -1 {
+		process = process[index+1:]
+	}
+
+	return process
+}
+
+func containsFold(values []string, value string) bool {
+	for _, item := range values {
+		if value != "" && strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
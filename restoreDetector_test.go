@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRestoreDetector(t *testing.T) {
+	config := Config{
+		restoreLoaderUsers:         []string{"LOADER"},
+		restoreLoaderProcesses:     []string{"gbak.exe"},
+		restoreWriteTransactionAge: time.Minute * 10,
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewRestoreDetector(&bytes.Buffer{}, Config{}))
+	})
+
+	t.Run("Restore is running", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetAttachmentsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$USER", "MON$REMOTE_PROCESS"}).
+				AddRow("SYSDBA  ", `C:\Program Files\Firebird\bin\gbak.exe`).
+				AddRow("loader", "/usr/bin/isql").
+				AddRow("WATCHER", "/app/secondary-db-watcher").
+				AddRow(nil, nil),
+		)
+		mock.ExpectQuery(regexp.QuoteMeta(GetWriteTransactionsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$ATTACHMENT_ID", "AGE"}).AddRow(10, 601).AddRow(11, 5),
+		)
+
+		activity, err := NewRestoreDetector(&bytes.Buffer{}, config).detect(db)
+
+		assert.NoError(t, err)
+		assert.True(t, activity.isRunning())
+		assert.Equal(t, restoreActivity{
+			LoaderAttachments: []string{"SYSDBA@gbak.exe", "loader@isql"},
+			LongTransactions:  1,
+		}, activity)
+		assert.Equal(t, "loader connections: [SYSDBA@gbak.exe, loader@isql], long write transactions: 1", activity.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Restore is not running", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetAttachmentsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$USER", "MON$REMOTE_PROCESS"}).AddRow("WATCHER", "/app/secondary-db-watcher"),
+		)
+		mock.ExpectQuery(regexp.QuoteMeta(GetWriteTransactionsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"MON$ATTACHMENT_ID", "AGE"}),
+		)
+
+		activity, err := NewRestoreDetector(&bytes.Buffer{}, config).detect(db)
+
+		assert.NoError(t, err)
+		assert.False(t, activity.isRunning())
+	})
+
+	t.Run("Only write transactions", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		mock.ExpectQuery(regexp.QuoteMeta(GetWriteTransactionsQuery)).WillReturnError(errors.New("no permission for SELECT access"))
+
+		_, err := NewRestoreDetector(&bytes.Buffer{}, Config{restoreWriteTransactionAge: time.Minute}).detect(db)
+
+		assert.EqualError(t, err, "no permission for SELECT access")
+	})
+
+	t.Run("Monitor privilege", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			result   func(mock sqlmock.Sqlmock)
+			warning  string
+			verified bool
+		}{
+			{
+				name: "granted",
+				result: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(regexp.QuoteMeta(GetMonitorPrivilegeQuery)).WillReturnRows(sqlmock.NewRows([]string{"GRANTED"}).AddRow(true))
+				},
+				verified: true,
+			},
+			{
+				name: "not granted",
+				result: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(regexp.QuoteMeta(GetMonitorPrivilegeQuery)).WillReturnRows(sqlmock.NewRows([]string{"GRANTED"}).AddRow(false))
+				},
+				warning:  "WARNING: secondary DB user has no MONITOR_ANY_ATTACHMENT privilege",
+				verified: true,
+			},
+			{
+				name: "not supported by Firebird 3",
+				result: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(regexp.QuoteMeta(GetMonitorPrivilegeQuery)).WillReturnError(errors.New("Function unknown RDB$SYSTEM_PRIVILEGE"))
+				},
+				warning:  "WARNING: failed to check MONITOR_ANY_ATTACHMENT privilege (Firebird 4+)",
+				verified: true,
+			},
+			{
+				name: "DB is not reachable",
+				result: func(mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(regexp.QuoteMeta(GetMonitorPrivilegeQuery)).WillReturnError(errors.New("Unable to complete network request"))
+				},
+				warning:  "retry on next iteration",
+				verified: false,
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				out := &bytes.Buffer{}
+				db, mock, _ := sqlmock.New()
+				testCase.result(mock)
+
+				detector := NewRestoreDetector(out, config)
+				detector.verifyPrivilege(db)
+				if testCase.verified {
+					detector.verifyPrivilege(db)
+				}
+
+				assert.Equal(t, testCase.verified, detector.privilegeVerified)
+				if testCase.warning == "" {
+					assert.Empty(t, out.String())
+				} else {
+					assert.Contains(t, out.String(), testCase.warning)
+				}
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+}
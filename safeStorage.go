@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/fileStorage"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// safeStorageRecord - stored file content: data with checksum to detect truncated or corrupted file
+type safeStorageRecord struct {
+	Checksum string
+	Data     string
+}
+
+var EmptyStorageFileError = errors.New("empty file")
+
+// restorableStorage can roll back the last write without backup rotation
+type restorableStorage interface {
+	restore(data []byte) error
+}
+
+// restoreStorage rolls back storage, which does not support restore, with regular write
+func restoreStorage(storage fileStorage.Interface, data []byte) error {
+	if restorable, ok := storage.(restorableStorage); ok {
+		return restorable.restore(data)
+	}
+
+	return storage.Set(data)
+}
+
+// candidateStorage saves stability candidate without backup rotation: announced state is not changed,
+// so candidate-only checks do not push known-good copies out of backups
+type candidateStorage interface {
+	setCandidate(data []byte) error
+}
+
+// saveCandidate saves candidate to storage, which does not support it, with regular write
+func saveCandidate(storage fileStorage.Interface, data []byte) error {
+	if candidates, ok := storage.(candidateStorage); ok {
+		return candidates.setCandidate(data)
+	}
+
+	return storage.Set(data)
+}
+
+// SafeStorage implements fileStorage.Interface with atomic writes (temp file, fsync, rename)
+// and keeps last backupCount known-good copies as "<file>.1" (newest) ... "<file>.N".
+type SafeStorage struct {
+	file        string
+	backupCount int
+	out         io.Writer
+}
+
+func NewSafeStorage(out io.Writer, config Config) *SafeStorage {
+	return &SafeStorage{
+		file:        config.storageFile,
+		backupCount: config.storageBackupCount,
+		out:         out,
+	}
+}
+
+// Get returns data from storage file, or from the newest valid backup when storage file is corrupted
+func (storage *SafeStorage) Get() ([]byte, error) {
+	data, err := readSafeStorageFile(storage.file)
+	if err == nil {
+		return data, nil
+	}
+
+	if (errors.Is(err, os.ErrNotExist) || errors.Is(err, EmptyStorageFileError)) && !storage.hasBackups() {
+		return nil, nil
+	}
+
+	for i := 1; i <= storage.backupCount; i++ {
+		backupData, backupErr := readSafeStorageFile(storage.backupFile(i))
+		if backupErr == nil {
+			fmt.Fprintf(
+				storage.out, "%s WARNING: storage file %s is corrupted (%s), recovered from backup %s\n",
+				getCurrentDatetime(), storage.file, err, storage.backupFile(i),
+			)
+			return backupData, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("storage file %s is corrupted and no valid backup found: %s", storage.file, err))
+}
+
+func (storage *SafeStorage) Set(data []byte) error {
+	storage.rotateBackups()
+	return storage.write(data)
+}
+
+// restore writes previous data back without backup rotation, so data which is rolled back never becomes a backup
+func (storage *SafeStorage) restore(data []byte) error {
+	return storage.write(data)
+}
+
+func (storage *SafeStorage) setCandidate(data []byte) error {
+	return storage.write(data)
+}
+
+func (storage *SafeStorage) write(data []byte) error {
+	record, _ := json.Marshal(safeStorageRecord{
+		Checksum: storageChecksum(data),
+		Data:     string(data),
+	})
+
+	tmpFile := storage.file + ".tmp"
+	file, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to write storage file %s: %s", storage.file, err))
+	}
+
+	_, err = file.Write(record)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, storage.file)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(storage.file))
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return errors.New(fmt.Sprintf("failed to write storage file %s: %s", storage.file, err))
+	}
+
+	return nil
+}
+
+// rotateBackups keeps current storage file as the newest backup, but only when it is valid
+func (storage *SafeStorage) rotateBackups() {
+	if storage.backupCount <= 0 {
+		return
+	}
+
+	if _, err := readSafeStorageFile(storage.file); err != nil {
+		return
+	}
+
+	for i := storage.backupCount - 1; i >= 1; i-- {
+		_ = os.Rename(storage.backupFile(i), storage.backupFile(i+1))
+	}
+
+	// hard link keeps storage file in place until it is replaced by rename
+	_ = os.Remove(storage.backupFile(1))
+	err := os.Link(storage.file, storage.backupFile(1))
+	if err != nil {
+		fmt.Fprintln(storage.out, getCurrentDatetime()+" Failed to backup storage file: "+err.Error())
+	}
+}
+
+func (storage *SafeStorage) hasBackups() bool {
+	for i := 1; i <= storage.backupCount; i++ {
+		if _, err := os.Stat(storage.backupFile(i)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (storage *SafeStorage) backupFile(number int) string {
+	return storage.file + "." + strconv.Itoa(number)
+}
+
+// readSafeStorageFile verifies checksum. File without checksum is valid only when it is bare dbState written before SafeStorage,
+// empty file is invalid: it is left by crash during write, so backup is used when it exists.
+func readSafeStorageFile(filename string) ([]byte, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, EmptyStorageFileError
+	}
+
+	var record safeStorageRecord
+	err = json.Unmarshal(content, &record)
+	if err != nil {
+		return nil, errors.New("invalid JSON: " + err.Error())
+	}
+
+	if record.Checksum == "" {
+		if !isLegacyStorageState(content) {
+			return nil, errors.New("no checksum")
+		}
+		return content, nil
+	}
+
+	if record.Checksum != storageChecksum([]byte(record.Data)) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	return []byte(record.Data), nil
+}
+
+// isLegacyStorageState - storage before SafeStorage contained bare dbState
+func isLegacyStorageState(content []byte) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(content, &fields) != nil {
+		return false
+	}
+
+	_, hasDatetime := fields["ActualDatetime"]
+	_, hasYear := fields["EducationYear"]
+
+	var state dbState
+	return (hasDatetime || hasYear) && json.Unmarshal(content, &state) == nil
+}
+
+// syncDir makes rename durable
+func syncDir(dirname string) error {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+func storageChecksum(data []byte) string {
+	checksum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(checksum[:])
+}
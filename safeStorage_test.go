@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func newTestSafeStorage(t *testing.T, out *bytes.Buffer) *SafeStorage {
+	return NewSafeStorage(out, Config{
+		storageFile:        t.TempDir() + "/storage.json",
+		storageBackupCount: 2,
+	})
+}
+
+func TestSafeStorage(t *testing.T) {
+	t.Run("Empty storage", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Empty(t, data)
+
+		_ = os.WriteFile(storage.file, []byte{}, 0644)
+		data, err = storage.Get()
+		assert.NoError(t, err)
+		assert.Empty(t, data)
+	})
+
+	t.Run("Set and get", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		err := storage.Set([]byte(`{"EducationYear":2023}`))
+		assert.NoError(t, err)
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"EducationYear":2023}`, string(data))
+
+		content, _ := os.ReadFile(storage.file)
+		assert.Contains(t, string(content), `"Checksum":"sha256:`)
+		assert.NoFileExists(t, storage.file+".tmp")
+	})
+
+	t.Run("Legacy file without checksum", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+		_ = os.WriteFile(storage.file, []byte(`{"EducationYear":2022}`), 0644)
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"EducationYear":2022}`, string(data))
+	})
+
+	t.Run("Keep last known-good copies", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		for i := 1; i <= 4; i++ {
+			assert.NoError(t, storage.Set([]byte(strconv.Itoa(i))))
+		}
+
+		backup, _ := readSafeStorageFile(storage.backupFile(1))
+		assert.Equal(t, "3", string(backup))
+		backup, _ = readSafeStorageFile(storage.backupFile(2))
+		assert.Equal(t, "2", string(backup))
+		assert.NoFileExists(t, storage.backupFile(3))
+	})
+
+	t.Run("Recover truncated file from backup", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		storage := newTestSafeStorage(t, out)
+
+		assert.NoError(t, storage.Set([]byte(`{"EducationYear":2022}`)))
+		assert.NoError(t, storage.Set([]byte(`{"EducationYear":2023}`)))
+
+		content, _ := os.ReadFile(storage.file)
+		_ = os.WriteFile(storage.file, content[:len(content)/2], 0644)
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"EducationYear":2022}`, string(data))
+		assert.Contains(t, out.String(), "WARNING: storage file "+storage.file+" is corrupted")
+
+		// corrupted file is not rotated to backups
+		assert.NoError(t, storage.Set([]byte(`{"EducationYear":2024}`)))
+		backup, _ := readSafeStorageFile(storage.backupFile(1))
+		assert.Equal(t, `{"EducationYear":2022}`, string(backup))
+	})
+
+	t.Run("Recover empty file from backup", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		assert.NoError(t, storage.Set([]byte("1")))
+		assert.NoError(t, storage.Set([]byte("2")))
+		_ = os.WriteFile(storage.file, []byte{}, 0644)
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(data))
+	})
+
+	t.Run("File without checksum is not legacy state", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+		_ = os.WriteFile(storage.file, []byte(`{"Data":"{}"}`), 0644)
+
+		data, err := storage.Get()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no checksum")
+		assert.Nil(t, data)
+	})
+
+	t.Run("Restore without backup rotation", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		assert.NoError(t, storage.Set([]byte("1")))
+		assert.NoError(t, storage.Set([]byte("2")))
+		assert.NoError(t, restoreStorage(storage, []byte("1")))
+
+		data, _ := storage.Get()
+		assert.Equal(t, "1", string(data))
+		backup, _ := readSafeStorageFile(storage.backupFile(1))
+		assert.Equal(t, "1", string(backup), "rolled back data is not a backup")
+		assert.NoFileExists(t, storage.backupFile(2))
+	})
+
+	t.Run("Candidate without backup rotation", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		assert.NoError(t, storage.Set([]byte("1")))
+		assert.NoError(t, storage.Set([]byte("2")))
+		for _, candidate := range []string{"2+a", "2+b", "2+c"} {
+			assert.NoError(t, saveCandidate(storage, []byte(candidate)))
+		}
+
+		data, _ := storage.Get()
+		assert.Equal(t, "2+c", string(data))
+		backup, _ := readSafeStorageFile(storage.backupFile(1))
+		assert.Equal(t, "1", string(backup), "known-good copy is kept")
+		assert.NoFileExists(t, storage.backupFile(2))
+	})
+
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		storage := newTestSafeStorage(t, out)
+		_ = os.WriteFile(storage.file, []byte(`{"Checksum":"sha256:00","Data":"{}"}`), 0644)
+
+		data, err := storage.Get()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "checksum mismatch")
+		assert.Nil(t, data)
+	})
+
+	t.Run("Recover missing file from backup", func(t *testing.T) {
+		storage := newTestSafeStorage(t, &bytes.Buffer{})
+
+		assert.NoError(t, storage.Set([]byte("1")))
+		assert.NoError(t, storage.Set([]byte("2")))
+		_ = os.Remove(storage.file)
+
+		data, err := storage.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(data))
+	})
+
+	t.Run("Write error", func(t *testing.T) {
+		storage := NewSafeStorage(&bytes.Buffer{}, Config{
+			storageFile:        os.TempDir() + "/not-exists-dir/storage.json",
+			storageBackupCount: 2,
+		})
+
+		err := storage.Set([]byte("1"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to write storage file")
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"os"
+	"strings"
+)
+
+// readSecret returns secret from file (Docker/Kubernetes secrets) when filename is set, otherwise plain value.
+// File is read on every call, so rotated secret is applied on the next connection.
+func readSecret(value string, filename string) (string, error) {
+	if filename == "" {
+		return value, nil
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to read secret file %s: %s", filename, err))
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// secretDsnConnector opens DB connections with DSN re-read from secret file for each new connection
+type secretDsnConnector struct {
+	driver  driver.Driver
+	dsn     string
+	dsnFile string
+}
+
+func (connector secretDsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := readSecret(connector.dsn, connector.dsnFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn driver.Conn
+	if driverContext, ok := connector.driver.(driver.DriverContext); ok {
+		dsnConnector, err := driverContext.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = dsnConnector.Connect(ctx)
+	} else {
+		conn, err = connector.driver.Open(dsn)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reconnectConn{conn: conn}, nil
+}
+
+func (connector secretDsnConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+func openSecondaryDekanatDb(config Config) (*sql.DB, error) {
+	return openDekanatDb(config, config.secondaryDekanatDbDSN, config.secondaryDekanatDbDSNFile)
+}
+
+func openPrimaryDekanatDb(config Config) (*sql.DB, error) {
+	return openDekanatDb(config, config.primaryDekanatDbDSN, config.primaryDekanatDbDSNFile)
+}
+
+func openDekanatDb(config Config, dsn string, dsnFile string) (*sql.DB, error) {
+	// sql.Open is used only to find registered driver by name
+	db, err := sql.Open(config.dekanatDbDriverName, "")
+	if err != nil {
+		return nil, err
+	}
+	dbDriver := db.Driver()
+	_ = db.Close()
+
+	db = sql.OpenDB(secretDsnConnector{
+		driver:  dbDriver,
+		dsn:     dsn,
+		dsnFile: dsnFile,
+	})
+
+	// connections are recreated periodically, so stale connections after Firebird restart do not stay in the pool
+	db.SetMaxOpenConns(config.secondaryDekanatDbMaxOpenConns)
+	db.SetConnMaxLifetime(config.secondaryDekanatDbConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.secondaryDekanatDbConnMaxIdleTime)
+
+	return db, nil
+}
+
+// secretSaslPlain - SASL PLAIN mechanism with password re-read from secret file for each new connection
+type secretSaslPlain struct {
+	username     string
+	password     string
+	passwordFile string
+}
+
+func (mechanism secretSaslPlain) Name() string {
+	return plain.Mechanism{}.Name()
+}
+
+func (mechanism secretSaslPlain) Start(ctx context.Context) (sasl.StateMachine, []byte, error) {
+	password, err := readSecret(mechanism.password, mechanism.passwordFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plain.Mechanism{
+		Username: mechanism.username,
+		Password: password,
+	}.Start(ctx)
+}
+
+// redactedError keeps original error for errors.Is, but hides secrets in message
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (redacted redactedError) Error() string {
+	return redacted.message
+}
+
+func (redacted redactedError) Unwrap() error {
+	return redacted.err
+}
+
+func hideSecrets(err error, config Config) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	for _, secret := range config.secrets() {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, maskedSecret)
+		}
+	}
+
+	if message == err.Error() {
+		return err
+	}
+
+	return redactedError{message: message, err: err}
+}
+
+// secrets - values loaded at start and current content of secret files, which could be rotated since start
+func (config Config) secrets() []string {
+	dsns := append(
+		currentSecrets(config.secondaryDekanatDbDSN, config.secondaryDekanatDbDSNFile),
+		currentSecrets(config.primaryDekanatDbDSN, config.primaryDekanatDbDSNFile)...,
+	)
+
+	var secrets []string
+	for _, dsn := range dsns {
+		secrets = append(secrets, dsn, dsnPassword(dsn))
+	}
+
+	secrets = append(secrets, currentSecrets(config.kafkaSaslPassword, config.kafkaSaslPasswordFile)...)
+	return append(secrets, currentSecrets(config.adminToken, config.adminTokenFile)...)
+}
+
+// currentSecrets returns loaded value and re-read content of secret file, when it is set and differs
+func currentSecrets(value string, filename string) []string {
+	current, err := readSecret(value, filename)
+	if err != nil || current == value {
+		return []string{value}
+	}
+
+	return []string{value, current}
+}
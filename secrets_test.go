@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+type dsnRecorderDriver struct {
+	dsnList []string
+}
+
+func (recorder *dsnRecorderDriver) Open(dsn string) (driver.Conn, error) {
+	recorder.dsnList = append(recorder.dsnList, dsn)
+	return nil, errors.New("connection refused for " + dsn)
+}
+
+var testDsnRecorderDriver = &dsnRecorderDriver{}
+
+func init() {
+	sql.Register("dsn-recorder", testDsnRecorderDriver)
+}
+
+func TestReadSecret(t *testing.T) {
+	secretFilename := os.TempDir() + "/secondary-db-watcher-secret"
+	defer os.Remove(secretFilename)
+
+	t.Run("Plain value", func(t *testing.T) {
+		secret, err := readSecret("plain", "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "plain", secret)
+	})
+
+	t.Run("From file", func(t *testing.T) {
+		_ = os.WriteFile(secretFilename, []byte("from-file\n"), 0600)
+		secret, err := readSecret("", secretFilename)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "from-file", secret)
+	})
+
+	t.Run("Not exists file", func(t *testing.T) {
+		secret, err := readSecret("", "not-exists-secret")
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read secret file not-exists-secret")
+		assert.Empty(t, secret)
+	})
+}
+
+func TestOpenSecondaryDekanatDb(t *testing.T) {
+	dsnFilename := os.TempDir() + "/secondary-db-watcher-dsn"
+	defer os.Remove(dsnFilename)
+
+	t.Run("DSN is re-read from file for new connection", func(t *testing.T) {
+		testDsnRecorderDriver.dsnList = nil
+
+		_ = os.WriteFile(dsnFilename, []byte("USER:FIRST@HOST/DATABASE\n"), 0600)
+		db, err := openSecondaryDekanatDb(Config{
+			dekanatDbDriverName:       "dsn-recorder",
+			secondaryDekanatDbDSN:     "USER:FIRST@HOST/DATABASE",
+			secondaryDekanatDbDSNFile: dsnFilename,
+		})
+		assert.NoError(t, err)
+
+		assert.Error(t, db.Ping())
+		_ = os.WriteFile(dsnFilename, []byte("USER:SECOND@HOST/DATABASE\n"), 0600)
+		assert.Error(t, db.Ping())
+
+		assert.Equal(t, []string{"USER:FIRST@HOST/DATABASE", "USER:SECOND@HOST/DATABASE"}, testDsnRecorderDriver.dsnList)
+	})
+
+	t.Run("Unknown driver", func(t *testing.T) {
+		db, err := openSecondaryDekanatDb(Config{
+			dekanatDbDriverName:   "dummy-not-exist",
+			secondaryDekanatDbDSN: "USER:PASSWORD@HOST/DATABASE",
+		})
+
+		assert.Nil(t, db)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "PASSWORD")
+	})
+}
+
+func TestSecretSaslPlain(t *testing.T) {
+	passwordFilename := os.TempDir() + "/secondary-db-watcher-kafka-password"
+	defer os.Remove(passwordFilename)
+
+	t.Run("Password from file", func(t *testing.T) {
+		_ = os.WriteFile(passwordFilename, []byte("kafka-password"), 0600)
+		mechanism := secretSaslPlain{username: "watcher", passwordFile: passwordFilename}
+
+		_, initialResponse, err := mechanism.Start(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, "PLAIN", mechanism.Name())
+		assert.Equal(t, "\x00watcher\x00kafka-password", string(initialResponse))
+	})
+
+	t.Run("Not exists password file", func(t *testing.T) {
+		mechanism := secretSaslPlain{username: "watcher", passwordFile: "not-exists-password"}
+
+		_, _, err := mechanism.Start(context.Background())
+
+		assert.Error(t, err)
+	})
+}
+
+func TestHideSecrets(t *testing.T) {
+	config := Config{
+		secondaryDekanatDbDSN: "USER:PASSWORD@HOST/DATABASE",
+		kafkaSaslPassword:     "kafka-password",
+	}
+
+	t.Run("Hide DSN and passwords", func(t *testing.T) {
+		originalErr := errors.New("dial USER:PASSWORD@HOST/DATABASE failed, password PASSWORD, kafka-password")
+		err := hideSecrets(originalErr, config)
+
+		assert.Equal(t, "dial ******"+" failed, password ******, ******", err.Error())
+		assert.ErrorIs(t, err, originalErr)
+	})
+
+	t.Run("Hide rotated secret from file", func(t *testing.T) {
+		passwordFile := t.TempDir() + "/kafka-password"
+		_ = os.WriteFile(passwordFile, []byte("rotated-password\n"), 0600)
+		rotatedConfig := config
+		rotatedConfig.kafkaSaslPasswordFile = passwordFile
+
+		originalErr := errors.New("auth failed for kafka-password and rotated-password")
+		err := hideSecrets(originalErr, rotatedConfig)
+
+		assert.Equal(t, "auth failed for ****** and ******", err.Error())
+	})
+
+	t.Run("Error without secrets", func(t *testing.T) {
+		originalErr := errors.New("dummy error")
+
+		assert.Equal(t, originalErr, hideSecrets(originalErr, config))
+		assert.NoError(t, hideSecrets(nil, config))
+	})
+}
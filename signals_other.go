@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// no user signals on this platform: check is started by admin API and status is served by status endpoint
+var checkSignal os.Signal
+var dumpSignal os.Signal
+
+var userSignals []os.Signal
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// checkSignal (SIGUSR1) starts check immediately, dumpSignal (SIGUSR2) logs status dump
+var checkSignal os.Signal = syscall.SIGUSR1
+var dumpSignal os.Signal = syscall.SIGUSR2
+
+var userSignals = []os.Signal{checkSignal, dumpSignal}
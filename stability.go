@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// stabilityCandidate - new DB state which is not announced until DB stays unchanged
+type stabilityCandidate struct {
+	State       dbState
+	FirstSeenAt time.Time
+	Checks      int
+}
+
+// StabilityPolicy - debounce mode: restore could still be in progress when new state is detected,
+// so it is announced only after requiredChecks consecutive checks with the same state or after quietPeriod.
+type StabilityPolicy struct {
+	requiredChecks int
+	quietPeriod    time.Duration
+
+	mutex     sync.Mutex
+	candidate *stabilityCandidate
+}
+
+type stabilityStatus struct {
+	RequiredChecks int
+	QuietPeriod    string              `json:",omitempty"`
+	Candidate      *stabilityCandidate `json:",omitempty"`
+}
+
+// NewStabilityPolicy returns nil when stability mode is disabled
+func NewStabilityPolicy(config Config) *StabilityPolicy {
+	if config.stabilityChecks == 0 && config.stabilityQuietPeriod == 0 {
+		return nil
+	}
+
+	return &StabilityPolicy{
+		requiredChecks: config.stabilityChecks,
+		quietPeriod:    config.stabilityQuietPeriod,
+	}
+}
+
+// observe returns candidate progress for current state and true when candidate is stable enough to be announced
+func (policy *StabilityPolicy) observe(previous *stabilityCandidate, state dbState, now time.Time) (stabilityCandidate, bool) {
+	candidate := stabilityCandidate{State: state, FirstSeenAt: now, Checks: 1}
+	if previous != nil && previous.State.isEqual(state) && previous.State.LastSessionId == state.LastSessionId {
+		candidate = *previous
+		candidate.Checks++
+	}
+
+	policy.mutex.Lock()
+	policy.candidate = &candidate
+	policy.mutex.Unlock()
+
+	stable := policy.requiredChecks > 0 && candidate.Checks >= policy.requiredChecks
+	stable = stable || policy.quietPeriod > 0 && now.Sub(candidate.FirstSeenAt) >= policy.quietPeriod
+
+	return candidate, stable
+}
+
+// announced forgets candidate after it is announced
+func (policy *StabilityPolicy) announced() {
+	policy.mutex.Lock()
+	policy.candidate = nil
+	policy.mutex.Unlock()
+}
+
+func (policy *StabilityPolicy) describe(candidate stabilityCandidate) string {
+	description := fmt.Sprintf(
+		"candidate %s: unchanged during %d checks since %s",
+		candidate.State.ActualDatetime.Format(StorageTimeFormat), candidate.Checks, candidate.FirstSeenAt.Format(StorageTimeFormat),
+	)
+	if policy.requiredChecks > 0 {
+		description += fmt.Sprintf(", %d checks required", policy.requiredChecks)
+	}
+	if policy.quietPeriod > 0 {
+		description += ", quiet period " + policy.quietPeriod.String()
+	}
+
+	return description
+}
+
+func (policy *StabilityPolicy) status() interface{} {
+	policy.mutex.Lock()
+	defer policy.mutex.Unlock()
+
+	status := stabilityStatus{
+		RequiredChecks: policy.requiredChecks,
+		Candidate:      policy.candidate,
+	}
+	if policy.quietPeriod > 0 {
+		status.QuietPeriod = policy.quietPeriod.String()
+	}
+
+	return status
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStabilityPolicy(t *testing.T) {
+	state := dbState{
+		ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, time.Local),
+		EducationYear:  2023,
+		LastSessionId:  100,
+	}
+	now := time.Date(2023, 9, 12, 4, 10, 0, 0, time.Local)
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, NewStabilityPolicy(Config{}))
+	})
+
+	t.Run("Required checks", func(t *testing.T) {
+		policy := NewStabilityPolicy(Config{stabilityChecks: 3})
+
+		candidate, stable := policy.observe(nil, state, now)
+		assert.False(t, stable)
+		assert.Equal(t, stabilityCandidate{State: state, FirstSeenAt: now, Checks: 1}, candidate)
+
+		candidate, stable = policy.observe(&candidate, state, now.Add(time.Minute))
+		assert.False(t, stable)
+		assert.Equal(t, 2, candidate.Checks)
+		assert.Equal(t, now, candidate.FirstSeenAt)
+
+		candidate, stable = policy.observe(&candidate, state, now.Add(time.Minute*2))
+		assert.True(t, stable)
+		assert.Equal(t, 3, candidate.Checks)
+	})
+
+	t.Run("Changed state restarts candidate", func(t *testing.T) {
+		policy := NewStabilityPolicy(Config{stabilityChecks: 2})
+
+		candidate, _ := policy.observe(nil, state, now)
+		changedState := state
+		changedState.LastSessionId++
+
+		candidate, stable := policy.observe(&candidate, changedState, now.Add(time.Minute))
+		assert.False(t, stable)
+		assert.Equal(t, stabilityCandidate{State: changedState, FirstSeenAt: now.Add(time.Minute), Checks: 1}, candidate)
+	})
+
+	t.Run("Quiet period", func(t *testing.T) {
+		policy := NewStabilityPolicy(Config{stabilityQuietPeriod: time.Minute * 30})
+
+		candidate, stable := policy.observe(nil, state, now)
+		assert.False(t, stable)
+
+		_, stable = policy.observe(&candidate, state, now.Add(time.Minute*29))
+		assert.False(t, stable)
+
+		_, stable = policy.observe(&candidate, state, now.Add(time.Minute*30))
+		assert.True(t, stable)
+	})
+
+	t.Run("Status and describe", func(t *testing.T) {
+		policy := NewStabilityPolicy(Config{stabilityChecks: 3, stabilityQuietPeriod: time.Hour})
+		candidate, _ := policy.observe(nil, state, now)
+
+		assert.Equal(t, stabilityStatus{RequiredChecks: 3, QuietPeriod: "1h0m0s", Candidate: &candidate}, policy.status())
+		assert.Equal(
+			t, "candidate "+state.ActualDatetime.Format(StorageTimeFormat)+": unchanged during 1 checks since "+
+				now.Format(StorageTimeFormat)+", 3 checks required, quiet period 1h0m0s",
+			policy.describe(candidate),
+		)
+
+		policy.announced()
+		assert.Equal(t, stabilityStatus{RequiredChecks: 3, QuietPeriod: "1h0m0s"}, policy.status())
+	})
+}
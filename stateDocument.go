@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kneu-messenger-pigeon/fileStorage"
+)
+
+// StateVersion - version of persisted state document schema. Bump it with migration only for incompatible changes,
+// new fields are added without new version: they are empty in stored documents.
+const StateVersion = 3
+
+// StateHistorySize - amount of previously announced states kept for replay
+const StateHistorySize = 100
+
+type stateDocument struct {
+	Version int
+	State   dbState
+	// History - previously announced states, oldest first
+	History []dbState
+	// Candidate - new state waiting for stability before announce
+	Candidate *stabilityCandidate `json:",omitempty"`
+}
+
+// stateMigration upgrades serialized document from version N (map key) to N+1
+type stateMigration func(serialized []byte) ([]byte, error)
+
+var stateMigrations = map[int]stateMigration{
+	1: migrateStateV1ToV2,
+	2: migrateStateV2ToV3,
+}
+
+func (document stateDocument) marshal() []byte {
+	document.Version = StateVersion
+	serialized, _ := json.Marshal(document)
+	return serialized
+}
+
+// next returns document with new state, current state goes to history
+func (document stateDocument) next(state dbState) stateDocument {
+	history := document.History
+	if !document.State.ActualDatetime.IsZero() {
+		history = append(history[:len(history):len(history)], document.State)
+	}
+
+	if len(history) > StateHistorySize {
+		history = history[len(history)-StateHistorySize:]
+	}
+
+	return stateDocument{
+		Version: StateVersion,
+		State:   state,
+		History: history,
+	}
+}
+
+// announcedStates returns history and current state, oldest first
+func (document stateDocument) announcedStates() []dbState {
+	states := append([]dbState{}, document.History...)
+	if !document.State.ActualDatetime.IsZero() {
+		states = append(states, document.State)
+	}
+
+	return states
+}
+
+func readStateDocument(storage fileStorage.Interface) (stateDocument, error) {
+	var document stateDocument
+	serialized, err := storage.Get()
+	if err == nil {
+		document, err = unmarshalStateDocument(serialized)
+	}
+
+	if err != nil {
+		return document, classifyError(StorageUnreadableError, errors.New("Failed to get DB state from Storage: "+err.Error()))
+	}
+
+	return document, nil
+}
+
+// unmarshalStateDocument upgrades old state documents, empty storage is empty document
+func unmarshalStateDocument(serialized []byte) (document stateDocument, err error) {
+	serialized = bytes.TrimSpace(serialized)
+	if len(serialized) == 0 {
+		return stateDocument{Version: StateVersion, History: []dbState{}}, nil
+	}
+
+	version, err := detectStateVersion(serialized)
+	if err != nil {
+		return document, err
+	}
+
+	if version < 1 || version > StateVersion {
+		return document, errors.New(fmt.Sprintf("unsupported state version %d, latest known is %d", version, StateVersion))
+	}
+
+	for ; version < StateVersion; version++ {
+		serialized, err = stateMigrations[version](serialized)
+		if err != nil {
+			return document, errors.New(fmt.Sprintf("failed to migrate state from version %d: %s", version, err))
+		}
+	}
+
+	err = json.Unmarshal(serialized, &document)
+	return document, err
+}
+
+// detectStateVersion - version 1 is bare dbState without Version field
+func detectStateVersion(serialized []byte) (int, error) {
+	var versioned struct {
+		Version int
+	}
+
+	err := json.Unmarshal(serialized, &versioned)
+	if err != nil {
+		return 0, err
+	}
+
+	if versioned.Version == 0 {
+		return 1, nil
+	}
+
+	return versioned.Version, nil
+}
+
+func migrateStateV1ToV2(serialized []byte) ([]byte, error) {
+	var state json.RawMessage
+	err := json.Unmarshal(serialized, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"Version": 2,
+		"State":   state,
+	})
+}
+
+// migrateStateV2ToV3 adds empty history: states announced before version 3 are unknown
+func migrateStateV2ToV3(serialized []byte) ([]byte, error) {
+	var document map[string]json.RawMessage
+	err := json.Unmarshal(serialized, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	document["Version"] = json.RawMessage("3")
+	document["History"] = json.RawMessage("[]")
+
+	return json.Marshal(document)
+}
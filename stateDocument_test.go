@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStateDocument(t *testing.T) {
+	loc := time.Local
+	expectedState := dbState{
+		ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, loc),
+		EducationYear:  2023,
+	}
+
+	t.Run("Marshal and unmarshal current version", func(t *testing.T) {
+		serialized := stateDocument{State: expectedState}.marshal()
+
+		var rawDocument map[string]interface{}
+		_ = json.Unmarshal(serialized, &rawDocument)
+		assert.Equal(t, float64(StateVersion), rawDocument["Version"])
+
+		document, err := unmarshalStateDocument(serialized)
+		assert.NoError(t, err)
+		assert.True(t, expectedState.isEqual(document.State), "Expected %v, actual %v", expectedState, document.State)
+	})
+
+	t.Run("Empty storage", func(t *testing.T) {
+		for _, serialized := range [][]byte{nil, {}, []byte(" \n")} {
+			document, err := unmarshalStateDocument(serialized)
+
+			assert.NoError(t, err)
+			assert.Equal(t, dbState{}, document.State)
+			assert.Empty(t, document.History)
+		}
+	})
+
+	t.Run("Next state keeps history", func(t *testing.T) {
+		document := stateDocument{}
+		for day := 1; day <= StateHistorySize+5; day++ {
+			document = document.next(dbState{
+				ActualDatetime: time.Date(2023, 9, day, 4, 0, 0, 0, loc),
+				EducationYear:  2023,
+			})
+		}
+
+		assert.Len(t, document.History, StateHistorySize)
+		assert.Equal(t, time.Date(2023, 9, StateHistorySize+5, 4, 0, 0, 0, loc), document.State.ActualDatetime)
+		assert.Equal(t, time.Date(2023, 9, StateHistorySize+4, 4, 0, 0, 0, loc), document.History[StateHistorySize-1].ActualDatetime)
+		assert.Len(t, document.announcedStates(), StateHistorySize+1)
+	})
+
+	t.Run("Every version has migration", func(t *testing.T) {
+		for version := 1; version < StateVersion; version++ {
+			assert.NotNilf(t, stateMigrations[version], "No migration from version %d", version)
+		}
+	})
+
+	t.Run("Unsupported future version", func(t *testing.T) {
+		futureVersion := StateVersion + 1
+		_, err := unmarshalStateDocument([]byte(fmt.Sprintf(`{"Version":%d,"State":{"EducationYear":2030}}`, futureVersion)))
+
+		assert.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("unsupported state version %d, latest known is %d", futureVersion, StateVersion), err.Error())
+	})
+
+	t.Run("Negative version", func(t *testing.T) {
+		_, err := unmarshalStateDocument([]byte(`{"Version":-1,"State":{"EducationYear":2030}}`))
+
+		assert.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("unsupported state version -1, latest known is %d", StateVersion), err.Error())
+	})
+
+	t.Run("Fields added after version 3 are empty", func(t *testing.T) {
+		document, err := unmarshalStateDocument([]byte(`{"Version":3,"State":{"EducationYear":2023},"History":[]}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), document.State.LastSessionId)
+		assert.True(t, document.State.Identity.isZero())
+		assert.Nil(t, document.Candidate)
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		_, err := unmarshalStateDocument([]byte(`{"Version":`))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrateStateV1ToV2(t *testing.T) {
+	t.Run("Bare dbState", func(t *testing.T) {
+		serialized, err := migrateStateV1ToV2([]byte(`{"ActualDatetime":"2023-09-12T04:00:00+03:00","EducationYear":2023}`))
+
+		assert.NoError(t, err)
+		assert.JSONEq(
+			t, `{"Version":2,"State":{"ActualDatetime":"2023-09-12T04:00:00+03:00","EducationYear":2023}}`,
+			string(serialized),
+		)
+	})
+
+	t.Run("Legacy state is upgraded on load", func(t *testing.T) {
+		document, err := unmarshalStateDocument([]byte(`{"ActualDatetime":"2023-09-12T04:00:00+03:00","EducationYear":2023}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2023, document.State.EducationYear)
+		assert.Equal(t, "2023-09-12T04:00:00+03:00", document.State.ActualDatetime.Format(time.RFC3339))
+		assert.Empty(t, document.History)
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		_, err := migrateStateV1ToV2([]byte(`{`))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrateStateV2ToV3(t *testing.T) {
+	t.Run("Add empty history", func(t *testing.T) {
+		serialized, err := migrateStateV2ToV3([]byte(`{"Version":2,"State":{"EducationYear":2023}}`))
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"Version":3,"State":{"EducationYear":2023},"History":[]}`, string(serialized))
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		_, err := migrateStateV2ToV3([]byte(`[]`))
+
+		assert.Error(t, err)
+	})
+}
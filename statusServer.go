@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type statusProvider func() interface{}
+
+// metricProvider returns current gauge value, metric is skipped while value is unknown
+type metricProvider func() (value float64, known bool)
+
+// labeledMetricProvider returns current values by label value, e.g. counts by trigger source
+type labeledMetricProvider func() map[string]float64
+
+type metric struct {
+	help            string
+	kind            string
+	provider        metricProvider
+	label           string
+	labeledProvider labeledMetricProvider
+}
+
+// StatusServer serves `GET /status` with JSON object of all registered sections
+// and `GET /metrics` with registered gauges and counters in Prometheus text format
+type StatusServer struct {
+	out    io.Writer
+	server *http.Server
+	mux    *http.ServeMux
+
+	mutex     sync.Mutex
+	sections  map[string]statusProvider
+	metrics   map[string]metric
+	startedAt time.Time
+}
+
+func NewStatusServer(out io.Writer, listen string) *StatusServer {
+	statusServer := &StatusServer{
+		out:       out,
+		sections:  map[string]statusProvider{},
+		metrics:   map[string]metric{},
+		startedAt: time.Now(),
+	}
+
+	statusServer.mux = http.NewServeMux()
+	statusServer.mux.HandleFunc("/status", statusServer.handleStatus)
+	statusServer.mux.HandleFunc("/metrics", statusServer.handleMetrics)
+
+	statusServer.server = &http.Server{
+		Addr:              listen,
+		Handler:           statusServer.mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	return statusServer
+}
+
+func (statusServer *StatusServer) register(name string, provider statusProvider) {
+	statusServer.mutex.Lock()
+	defer statusServer.mutex.Unlock()
+
+	statusServer.sections[name] = provider
+}
+
+func (statusServer *StatusServer) registerMetric(name string, help string, provider metricProvider) {
+	statusServer.mutex.Lock()
+	defer statusServer.mutex.Unlock()
+
+	statusServer.metrics[name] = metric{help: help, kind: "gauge", provider: provider}
+}
+
+// registerLabeledMetric adds metric of kind "gauge" or "counter" with one label
+func (statusServer *StatusServer) registerLabeledMetric(name string, help string, kind string, label string, provider labeledMetricProvider) {
+	statusServer.mutex.Lock()
+	defer statusServer.mutex.Unlock()
+
+	statusServer.metrics[name] = metric{help: help, kind: kind, label: label, labeledProvider: provider}
+}
+
+// handle adds endpoint served by the same listener, e.g. admin API
+func (statusServer *StatusServer) handle(pattern string, handler http.HandlerFunc) {
+	statusServer.mux.HandleFunc(pattern, handler)
+}
+
+// start is no-op when listen address is not configured
+func (statusServer *StatusServer) start() {
+	if statusServer.server.Addr == "" {
+		return
+	}
+
+	go func() {
+		err := statusServer.server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(statusServer.out, getCurrentDatetime()+" Status server error: "+err.Error())
+		}
+	}()
+}
+
+func (statusServer *StatusServer) close() {
+	if statusServer.server.Addr == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_ = statusServer.server.Shutdown(ctx)
+}
+
+func (statusServer *StatusServer) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(statusServer.snapshot())
+}
+
+func (statusServer *StatusServer) snapshot() map[string]interface{} {
+	statusServer.mutex.Lock()
+	defer statusServer.mutex.Unlock()
+
+	status := map[string]interface{}{
+		"startedAt": statusServer.startedAt,
+	}
+	for name, provider := range statusServer.sections {
+		status[name] = provider()
+	}
+
+	return status
+}
+
+// dump - all status sections as one-line JSON for the log, e.g. on SIGUSR2
+func (statusServer *StatusServer) dump() string {
+	serialized, err := json.Marshal(statusServer.snapshot())
+	if err != nil {
+		return "failed to dump status: " + err.Error()
+	}
+
+	return string(serialized)
+}
+
+func (statusServer *StatusServer) handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	statusServer.mutex.Lock()
+	names := make([]string, 0, len(statusServer.metrics))
+	for name := range statusServer.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	for _, name := range names {
+		statusServer.metrics[name].write(&body, name)
+	}
+	statusServer.mutex.Unlock()
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = io.WriteString(writer, body.String())
+}
+
+func (metric metric) write(body *strings.Builder, name string) {
+	header := fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, metric.help, name, metric.kind)
+
+	if metric.labeledProvider == nil {
+		value, known := metric.provider()
+		if known {
+			fmt.Fprintf(body, "%s%s %s\n", header, name, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		return
+	}
+
+	values := metric.labeledProvider()
+	labelValues := make([]string, 0, len(values))
+	for labelValue := range values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	body.WriteString(header)
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(body, "%s{%s=%q} %s\n", name, metric.label, labelValue, strconv.FormatFloat(values[labelValue], 'f', -1, 64))
+	}
+}
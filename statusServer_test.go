@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusServer(t *testing.T) {
+	t.Run("Status with sections", func(t *testing.T) {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+		statusServer.register("dummy", func() interface{} {
+			return map[string]int{"value": 42}
+		})
+
+		recorder := httptest.NewRecorder()
+		statusServer.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		var status map[string]interface{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &status)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, map[string]interface{}{"value": float64(42)}, status["dummy"])
+		assert.NotEmpty(t, status["startedAt"])
+	})
+
+	t.Run("Dump", func(t *testing.T) {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+		statusServer.register("dummy", func() interface{} {
+			return map[string]int{"value": 42}
+		})
+
+		assert.Contains(t, statusServer.dump(), `"dummy":{"value":42}`)
+		assert.Contains(t, statusServer.dump(), `"startedAt":`)
+	})
+
+	t.Run("Wrong method", func(t *testing.T) {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+
+		recorder := httptest.NewRecorder()
+		statusServer.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/status", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+		statusServer.registerMetric("watcher_unknown", "Not measured yet", func() (float64, bool) {
+			return 0, false
+		})
+		statusServer.registerMetric("watcher_lag_seconds", "Lag", func() (float64, bool) {
+			return 3600.5, true
+		})
+
+		recorder := httptest.NewRecorder()
+		statusServer.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "# HELP watcher_lag_seconds Lag\n# TYPE watcher_lag_seconds gauge\nwatcher_lag_seconds 3600.5\n", recorder.Body.String())
+	})
+
+	t.Run("Labeled metrics", func(t *testing.T) {
+		statusServer := NewStatusServer(&bytes.Buffer{}, "")
+		statusServer.registerLabeledMetric("checks_total", "Checks", "counter", "source", func() map[string]float64 {
+			return map[string]float64{"poll": 3, "db_event": 1}
+		})
+
+		recorder := httptest.NewRecorder()
+		statusServer.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(
+			t,
+			"# HELP checks_total Checks\n# TYPE checks_total counter\nchecks_total{source=\"db_event\"} 1\nchecks_total{source=\"poll\"} 3\n",
+			recorder.Body.String(),
+		)
+	})
+
+	t.Run("Listen and close", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		statusServer := NewStatusServer(out, "127.0.0.1:0")
+
+		statusServer.start()
+		statusServer.close()
+
+		assert.Empty(t, out.String())
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var StorageLockedError = errors.New("storage is locked by another process")
+var FileLockedError = errors.New("file is locked by another process")
+
+type storageLockHolder struct {
+	Pid      int
+	Host     string
+	LockedAt time.Time
+}
+
+// StorageLock is advisory exclusive lock for storage file. Separate ".lock" file is used,
+// because the storage file itself could be replaced on write.
+type StorageLock struct {
+	file *os.File
+}
+
+func lockStorage(storageFile string) (*StorageLock, error) {
+	lockFilename := storageFile + ".lock"
+	file, err := os.OpenFile(lockFilename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open storage lock file %s: %s", lockFilename, err))
+	}
+
+	err = lockFile(file, false)
+	if errors.Is(err, FileLockedError) {
+		holder := readStorageLockHolder(file)
+		_ = file.Close()
+		return nil, fmt.Errorf(
+			"%w: %s is locked by PID %d on host %s since %s",
+			StorageLockedError, storageFile, holder.Pid, holder.Host, holder.LockedAt.Format(time.RFC3339),
+		)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, errors.New(fmt.Sprintf("Failed to lock storage file %s: %s", storageFile, err))
+	}
+
+	hostname, _ := os.Hostname()
+	holder, _ := json.Marshal(storageLockHolder{
+		Pid:      os.Getpid(),
+		Host:     hostname,
+		LockedAt: time.Now(),
+	})
+
+	_ = file.Truncate(0)
+	_, _ = file.WriteAt(holder, 0)
+
+	return &StorageLock{file: file}, nil
+}
+
+func (lock *StorageLock) unlock() {
+	_ = unlockFile(lock.file)
+	_ = lock.file.Close()
+}
+
+func readStorageLockHolder(file *os.File) (holder storageLockHolder) {
+	content, err := io.ReadAll(file)
+	if err == nil {
+		_ = json.Unmarshal(content, &holder)
+	}
+
+	return holder
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestLockStorage(t *testing.T) {
+	storageFile := os.TempDir() + "/secondary-db-watcher-lock-storage.json"
+	defer os.Remove(storageFile + ".lock")
+
+	t.Run("Lock and unlock", func(t *testing.T) {
+		lock, err := lockStorage(storageFile)
+		assert.NoError(t, err)
+
+		_, err = lockStorage(storageFile)
+		assert.ErrorIs(t, err, StorageLockedError)
+		assert.Contains(t, err.Error(), fmt.Sprintf("locked by PID %d", os.Getpid()))
+
+		hostname, _ := os.Hostname()
+		assert.Contains(t, err.Error(), "on host "+hostname)
+
+		lock.unlock()
+
+		lock, err = lockStorage(storageFile)
+		assert.NoError(t, err, "storage should be unlocked")
+		lock.unlock()
+	})
+
+	t.Run("Not writable lock file", func(t *testing.T) {
+		lock, err := lockStorage(os.TempDir() + "/not-exists-dir/storage.json")
+
+		assert.Nil(t, lock)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, StorageLockedError)
+		assert.Contains(t, err.Error(), "Failed to open storage lock file")
+	})
+}
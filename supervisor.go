@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const SelfTestTimeout = time.Second * 10
+
+// Supervisor recovers the watcher in-process instead of exiting on TooManyError:
+// recreates DB pool and Kafka writer, runs self-test and restarts the main loop.
+// It gives up after maxRecoveries failed recovery cycles in a row.
+type Supervisor struct {
+	out              io.Writer
+	maxRecoveries    int
+	pause            time.Duration
+	recoverResources func() error
+
+	mutex            sync.Mutex
+	recoveries       int
+	failedRecoveries int
+	lastRecoveryAt   time.Time
+	lastError        error
+}
+
+type supervisorStatus struct {
+	Recoveries       int
+	FailedRecoveries int
+	MaxRecoveries    int
+	LastRecoveryAt   time.Time `json:",omitempty"`
+	LastError        string    `json:",omitempty"`
+}
+
+func NewSupervisor(out io.Writer, config Config, recoverResources func() error) *Supervisor {
+	return &Supervisor{
+		out:              out,
+		maxRecoveries:    config.supervisorMaxRecoveries,
+		pause:            config.pauseAfterError,
+		recoverResources: recoverResources,
+	}
+}
+
+// enabled - without SUPERVISOR_MAX_RECOVERIES process exits on TooManyError and relies on Docker restart
+func (supervisor *Supervisor) enabled() bool {
+	return supervisor.maxRecoveries > 0
+}
+
+// run restarts mainLoop after recovery. Recovery cycle is failed when recovery or self-test fails,
+// or when the main loop breaks again without any successful iteration.
+func (supervisor *Supervisor) run(mainLoop func(iterationExecutor func() error) error, iterationExecutor func() error) error {
+	// executor runs on watchdog goroutine, abandoned iteration could finish later
+	var succeeded atomic.Bool
+	executor := func() error {
+		err := iterationExecutor()
+		if err == nil {
+			succeeded.Store(true)
+		}
+		return err
+	}
+
+	err := mainLoop(executor)
+	for supervisor.enabled() && errors.Is(err, TooManyError) && !errors.Is(err, PermanentError) {
+		supervisor.mutex.Lock()
+		if succeeded.Swap(false) {
+			supervisor.failedRecoveries = 0
+		}
+		supervisor.lastError = err
+		failedRecoveries := supervisor.failedRecoveries
+		supervisor.mutex.Unlock()
+
+		if failedRecoveries >= supervisor.maxRecoveries {
+			fmt.Fprintf(supervisor.out, "Supervisor gives up after %d failed recovery cycles\n", failedRecoveries)
+			return err
+		}
+
+		fmt.Fprintln(supervisor.out, getCurrentDatetime()+" Supervisor recovers after: "+err.Error())
+		recoverErr := supervisor.recoverResources()
+
+		supervisor.mutex.Lock()
+		supervisor.recoveries++
+		supervisor.lastRecoveryAt = time.Now()
+		if recoverErr != nil {
+			supervisor.failedRecoveries++
+			supervisor.lastError = recoverErr
+		}
+		supervisor.mutex.Unlock()
+
+		if recoverErr != nil {
+			fmt.Fprintln(supervisor.out, getCurrentDatetime()+" Supervisor recovery failed: "+recoverErr.Error())
+			err = fmt.Errorf("%w: %w", TooManyError, recoverErr)
+			if !supervisor.wait() {
+				return nil
+			}
+			continue
+		}
+
+		// counted as failed until the first successful iteration
+		supervisor.mutex.Lock()
+		supervisor.failedRecoveries++
+		supervisor.mutex.Unlock()
+
+		fmt.Fprintln(supervisor.out, getCurrentDatetime()+" Supervisor recovery done, restart main loop")
+		err = mainLoop(executor)
+	}
+
+	return err
+}
+
+// wait pauses between failed recovery cycles, returns false when cancelled by signal
+func (supervisor *Supervisor) wait() bool {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	select {
+	case <-time.After(supervisor.pause):
+		return true
+	case <-sig:
+		fmt.Fprintln(supervisor.out, "cancelled")
+		return false
+	}
+}
+
+func (supervisor *Supervisor) status() interface{} {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	status := supervisorStatus{
+		Recoveries:       supervisor.recoveries,
+		FailedRecoveries: supervisor.failedRecoveries,
+		MaxRecoveries:    supervisor.maxRecoveries,
+		LastRecoveryAt:   supervisor.lastRecoveryAt,
+	}
+	if supervisor.lastError != nil {
+		status.LastError = supervisor.lastError.Error()
+	}
+
+	return status
+}
+
+// selfTest checks recreated DB pool and Kafka broker availability before restart of the main loop
+func selfTest(secondaryDekanatDb *sql.DB, config Config) error {
+	err := secondaryDekanatDb.Ping()
+	if err != nil {
+		return classifyError(DbUnreachableError, errors.New("self-test: failed to ping secondary Dekanat DB: "+err.Error()))
+	}
+
+	connection, err := net.DialTimeout("tcp", config.kafkaHost, SelfTestTimeout)
+	if err != nil {
+		return classifyError(KafkaUnreachableError, errors.New("self-test: failed to connect to Kafka: "+err.Error()))
+	}
+
+	return connection.Close()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	tooManyErr := fmt.Errorf("%w: %w", TooManyError, errors.New("dummy error"))
+
+	t.Run("Disabled", func(t *testing.T) {
+		var out bytes.Buffer
+		recoverCount := 0
+		supervisor := NewSupervisor(&out, Config{}, func() error {
+			recoverCount++
+			return nil
+		})
+
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			return tooManyErr
+		}, func() error { return nil })
+
+		assert.Equal(t, tooManyErr, err)
+		assert.Equal(t, 0, recoverCount)
+	})
+
+	t.Run("Recover and continue", func(t *testing.T) {
+		var out bytes.Buffer
+		recoverCount := 0
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 1}, func() error {
+			recoverCount++
+			return nil
+		})
+
+		loopResults := []error{tooManyErr, tooManyErr, BreakLoopError}
+		loopCount := 0
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			// every restarted loop has successful iteration
+			_ = iterationExecutor()
+			loopCount++
+			return loopResults[loopCount-1]
+		}, func() error { return nil })
+
+		assert.ErrorIs(t, err, BreakLoopError)
+		assert.Equal(t, 3, loopCount)
+		assert.Equal(t, 2, recoverCount)
+		assert.Contains(t, out.String(), "Supervisor recovery done, restart main loop")
+		assert.Equal(t, supervisorStatus{Recoveries: 2, FailedRecoveries: 1, MaxRecoveries: 1, LastRecoveryAt: supervisor.lastRecoveryAt, LastError: tooManyErr.Error()}, supervisor.status())
+	})
+
+	t.Run("Give up after failed recovery cycles", func(t *testing.T) {
+		var out bytes.Buffer
+		recoverErr := classifyError(KafkaUnreachableError, errors.New("self-test: failed to connect to Kafka"))
+		recoverCount := 0
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 2}, func() error {
+			recoverCount++
+			return recoverErr
+		})
+
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			return tooManyErr
+		}, func() error { return nil })
+
+		assert.ErrorIs(t, err, TooManyError)
+		assert.ErrorIs(t, err, KafkaUnreachableError)
+		assert.Equal(t, 2, recoverCount)
+		assert.Contains(t, out.String(), "Supervisor recovery failed: self-test: failed to connect to Kafka")
+		assert.Contains(t, out.String(), "Supervisor gives up after 2 failed recovery cycles")
+	})
+
+	t.Run("Restarted loop without success is failed cycle", func(t *testing.T) {
+		var out bytes.Buffer
+		recoverCount := 0
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 1}, func() error {
+			recoverCount++
+			return nil
+		})
+
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			_ = iterationExecutor()
+			return tooManyErr
+		}, func() error { return errors.New("dummy error") })
+
+		assert.Equal(t, tooManyErr, err)
+		assert.Equal(t, 1, recoverCount)
+	})
+
+	t.Run("Permanent error is not recovered", func(t *testing.T) {
+		var out bytes.Buffer
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 1}, func() error {
+			t.Fatal("recovery is not expected")
+			return nil
+		})
+
+		permanentErr := fmt.Errorf("%w: %w", PermanentError, DbSchemaMismatchError)
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			return permanentErr
+		}, func() error { return nil })
+
+		assert.Equal(t, permanentErr, err)
+	})
+
+	t.Run("Recovery fails while hung iteration holds lock", func(t *testing.T) {
+		var out bytes.Buffer
+		lock := newIterationLock()
+		release := make(chan struct{})
+		defer close(release)
+
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 1}, func() error {
+			err := lock.lockTimeout(time.Millisecond * 10)
+			if err != nil {
+				return err
+			}
+			defer lock.unlock()
+
+			return nil
+		})
+
+		hungIteration := guardIteration(&out, time.Millisecond*10, func() error {
+			_ = lock.lock(context.Background())
+			defer lock.unlock()
+
+			<-release
+			return nil
+		})
+
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			return fmt.Errorf("%w: %w", TooManyError, iterationExecutor())
+		}, hungIteration)
+
+		assert.ErrorIs(t, err, TooManyError)
+		assert.ErrorIs(t, err, IterationHungError)
+		assert.Contains(t, out.String(), "Supervisor recovery failed: iteration hung: iteration lock is held longer than 10ms")
+		assert.Contains(t, out.String(), "Supervisor gives up after 1 failed recovery cycles")
+	})
+
+	t.Run("Abandoned iteration finishes during recovery", func(t *testing.T) {
+		var out bytes.Buffer
+		release := make(chan struct{})
+		supervisor := NewSupervisor(&out, Config{supervisorMaxRecoveries: 1}, func() error {
+			return nil
+		})
+
+		loopResults := []error{tooManyErr, BreakLoopError}
+		loopCount := 0
+		err := supervisor.run(func(iterationExecutor func() error) error {
+			loopCount++
+			if loopCount == 1 {
+				assert.ErrorIs(t, guardIteration(&out, time.Millisecond*10, iterationExecutor)(), IterationHungError)
+				// abandoned iteration succeeds while supervisor recovers
+				close(release)
+			}
+			return loopResults[loopCount-1]
+		}, func() error {
+			<-release
+			return nil
+		})
+
+		assert.ErrorIs(t, err, BreakLoopError)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const terminationReportErrorsLimit = 10
+
+type terminationReportError struct {
+	Time  time.Time
+	Error string
+}
+
+// TerminationReport collects last errors and state to write JSON report on exit (e.g. to /dev/termination-log)
+type TerminationReport struct {
+	file string
+
+	mutex      sync.Mutex
+	lastErrors []terminationReportError
+	lastState  dbState
+}
+
+type terminationReportContent struct {
+	ExitCode     int
+	Error        string `json:",omitempty"`
+	LastErrors   []terminationReportError
+	LastState    dbState
+	TerminatedAt time.Time
+}
+
+func NewTerminationReport(file string) *TerminationReport {
+	return &TerminationReport{
+		file:       file,
+		lastErrors: []terminationReportError{},
+	}
+}
+
+func (report *TerminationReport) record(result checkResult, err error) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if !result.CurrentState.ActualDatetime.IsZero() {
+		report.lastState = result.CurrentState
+	}
+
+	if err != nil {
+		report.lastErrors = append(report.lastErrors, terminationReportError{
+			Time:  time.Now(),
+			Error: err.Error(),
+		})
+	}
+
+	if len(report.lastErrors) > terminationReportErrorsLimit {
+		report.lastErrors = report.lastErrors[len(report.lastErrors)-terminationReportErrorsLimit:]
+	}
+}
+
+// write is no-op when report file is not configured
+func (report *TerminationReport) write(err error) error {
+	if report.file == "" {
+		return nil
+	}
+
+	report.mutex.Lock()
+	content := terminationReportContent{
+		ExitCode:     getExitCode(err),
+		LastErrors:   report.lastErrors,
+		LastState:    report.lastState,
+		TerminatedAt: time.Now(),
+	}
+	report.mutex.Unlock()
+
+	if err != nil {
+		content.Error = err.Error()
+	}
+
+	serialized, _ := json.MarshalIndent(content, "", "  ")
+	return os.WriteFile(report.file, serialized, 0644)
+}
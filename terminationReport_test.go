@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTerminationReport(t *testing.T) {
+	state := dbState{
+		ActualDatetime: time.Date(2023, 9, 12, 4, 0, 0, 0, time.Local),
+		EducationYear:  2023,
+	}
+
+	t.Run("Write last errors and state", func(t *testing.T) {
+		report := NewTerminationReport(t.TempDir() + "/termination-log")
+
+		report.record(checkResult{Status: CheckResultUnchanged, CurrentState: state}, nil)
+		for i := 0; i < terminationReportErrorsLimit+2; i++ {
+			report.record(checkResult{}, errors.New(fmt.Sprintf("dummy error %d", i)))
+		}
+
+		err := report.write(fmt.Errorf("%w: %w", TooManyError, errors.New("dummy error")))
+		assert.NoError(t, err)
+
+		var content terminationReportContent
+		serialized, _ := os.ReadFile(report.file)
+		assert.NoError(t, json.Unmarshal(serialized, &content))
+
+		assert.Equal(t, ExitCodeTooManyErrorInLoop, content.ExitCode)
+		assert.Equal(t, "too many error: dummy error", content.Error)
+		assert.Len(t, content.LastErrors, terminationReportErrorsLimit)
+		assert.Equal(t, "dummy error 2", content.LastErrors[0].Error)
+		assert.True(t, state.isEqual(content.LastState))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		report := NewTerminationReport("")
+
+		assert.NoError(t, report.write(errors.New("dummy error")))
+	})
+
+	t.Run("Write error", func(t *testing.T) {
+		report := NewTerminationReport(os.TempDir() + "/not-exists-dir/termination-log")
+
+		assert.Error(t, report.write(nil))
+	})
+}
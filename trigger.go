@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const TriggerSourcePoll = "poll"
+const TriggerSourceDbEvent = "dbEvent"
+const TriggerSourceAdmin = "admin"
+const TriggerSourceSignal = "signal"
+const TriggerSourceFileWatch = "fileWatch"
+
+// IterationTrigger wakes the main loop before the pause ends. Source of the pending trigger
+// is taken by the next iteration, so detection metrics show which path detected each load.
+type IterationTrigger struct {
+	wakeup chan struct{}
+
+	mutex         sync.Mutex
+	pendingSource string
+	checks        map[string]int
+	loads         map[string]int
+	lastLoadBy    string
+	lastLoadAt    time.Time
+}
+
+type detectionStatus struct {
+	Checks     map[string]int
+	Loads      map[string]int
+	LastLoadBy string    `json:",omitempty"`
+	LastLoadAt time.Time `json:",omitempty"`
+}
+
+func NewIterationTrigger() *IterationTrigger {
+	return &IterationTrigger{
+		wakeup: make(chan struct{}, 1),
+		checks: map[string]int{},
+		loads:  map[string]int{},
+	}
+}
+
+// fire never blocks: several triggers during one iteration cause only one extra iteration
+func (trigger *IterationTrigger) fire(source string) {
+	trigger.mutex.Lock()
+	if trigger.pendingSource == "" {
+		trigger.pendingSource = source
+	}
+	trigger.mutex.Unlock()
+
+	select {
+	case trigger.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// takeSource returns source of pending trigger, or TriggerSourcePoll when iteration is started after pause
+func (trigger *IterationTrigger) takeSource() string {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	source := trigger.pendingSource
+	trigger.pendingSource = ""
+	if source == "" {
+		source = TriggerSourcePoll
+	}
+
+	trigger.checks[source]++
+	return source
+}
+
+// recordCheck counts check started outside of the main loop, e.g. by admin API
+func (trigger *IterationTrigger) recordCheck(source string) {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	trigger.checks[source]++
+}
+
+func (trigger *IterationTrigger) recordLoad(source string, now time.Time) {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	trigger.loads[source]++
+	trigger.lastLoadBy = source
+	trigger.lastLoadAt = now
+}
+
+func (trigger *IterationTrigger) status() interface{} {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	status := detectionStatus{
+		Checks:     map[string]int{},
+		Loads:      map[string]int{},
+		LastLoadBy: trigger.lastLoadBy,
+		LastLoadAt: trigger.lastLoadAt,
+	}
+	for source, count := range trigger.checks {
+		status.Checks[source] = count
+	}
+	for source, count := range trigger.loads {
+		status.Loads[source] = count
+	}
+
+	return status
+}
+
+// checkCounts - metric of checks by trigger source
+func (trigger *IterationTrigger) checkCounts() map[string]float64 {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	return countsMetric(trigger.checks)
+}
+
+// loadCounts - metric of detected loads by trigger source
+func (trigger *IterationTrigger) loadCounts() map[string]float64 {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	return countsMetric(trigger.loads)
+}
+
+// lastLoadTimestamp - metric is unknown until the first detected load
+func (trigger *IterationTrigger) lastLoadTimestamp() (float64, bool) {
+	trigger.mutex.Lock()
+	defer trigger.mutex.Unlock()
+
+	return float64(trigger.lastLoadAt.Unix()), !trigger.lastLoadAt.IsZero()
+}
+
+func countsMetric(counts map[string]int) map[string]float64 {
+	values := make(map[string]float64, len(counts))
+	for source, count := range counts {
+		values[source] = float64(count)
+	}
+
+	return values
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestIterationTrigger(t *testing.T) {
+	t.Run("Poll without trigger", func(t *testing.T) {
+		trigger := NewIterationTrigger()
+
+		assert.Equal(t, TriggerSourcePoll, trigger.takeSource())
+		assert.Len(t, trigger.wakeup, 0)
+	})
+
+	t.Run("Fire wakes up once and keeps first source", func(t *testing.T) {
+		trigger := NewIterationTrigger()
+
+		trigger.fire(TriggerSourceDbEvent)
+		trigger.fire("other")
+
+		assert.Len(t, trigger.wakeup, 1)
+		assert.Equal(t, TriggerSourceDbEvent, trigger.takeSource())
+		assert.Equal(t, TriggerSourcePoll, trigger.takeSource())
+	})
+
+	t.Run("Check outside of main loop keeps pending source", func(t *testing.T) {
+		trigger := NewIterationTrigger()
+
+		trigger.fire(TriggerSourceDbEvent)
+		trigger.recordCheck(TriggerSourceAdmin)
+
+		assert.Equal(t, TriggerSourceDbEvent, trigger.takeSource())
+		assert.Equal(t, 1, trigger.status().(detectionStatus).Checks[TriggerSourceAdmin])
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		trigger := NewIterationTrigger()
+		loadedAt := time.Date(2024, 3, 1, 4, 0, 0, 0, time.UTC)
+
+		trigger.fire(TriggerSourceDbEvent)
+		trigger.recordLoad(trigger.takeSource(), loadedAt)
+		trigger.takeSource()
+
+		assert.Equal(t, detectionStatus{
+			Checks:     map[string]int{TriggerSourceDbEvent: 1, TriggerSourcePoll: 1},
+			Loads:      map[string]int{TriggerSourceDbEvent: 1},
+			LastLoadBy: TriggerSourceDbEvent,
+			LastLoadAt: loadedAt,
+		}, trigger.status())
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		trigger := NewIterationTrigger()
+		loadedAt := time.Date(2024, 3, 1, 4, 0, 0, 0, time.UTC)
+
+		_, known := trigger.lastLoadTimestamp()
+		assert.False(t, known)
+
+		trigger.fire(TriggerSourceDbEvent)
+		trigger.recordLoad(trigger.takeSource(), loadedAt)
+		trigger.takeSource()
+
+		assert.Equal(t, map[string]float64{TriggerSourceDbEvent: 1, TriggerSourcePoll: 1}, trigger.checkCounts())
+		assert.Equal(t, map[string]float64{TriggerSourceDbEvent: 1}, trigger.loadCounts())
+
+		timestamp, known := trigger.lastLoadTimestamp()
+		assert.True(t, known)
+		assert.Equal(t, float64(loadedAt.Unix()), timestamp)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var IterationPanicError = errors.New("iteration panic")
+var IterationHungError = errors.New("iteration hung")
+
+// iterationGuard recovers iteration panic with stack trace and abandons iteration after timeout (0 disables watchdog).
+// Next iteration is not started while abandoned one is still running, so they never update storage concurrently.
+// Guard is safe for concurrent use, e.g. by admin API requests: iterations are run one by one.
+type iterationGuard struct {
+	out     io.Writer
+	timeout time.Duration
+
+	mutex     sync.Mutex
+	abandoned chan error
+}
+
+func newIterationGuard(out io.Writer, timeout time.Duration) *iterationGuard {
+	return &iterationGuard{
+		out:     out,
+		timeout: timeout,
+	}
+}
+
+// guardIteration - iterationExecutor guarded by own iterationGuard
+func guardIteration(out io.Writer, timeout time.Duration, iterationExecutor func() error) func() error {
+	guard := newIterationGuard(out, timeout)
+
+	return func() error {
+		return guard.run(iterationExecutor)
+	}
+}
+
+func (guard *iterationGuard) run(iterationExecutor func() error) error {
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	if guard.abandoned != nil {
+		select {
+		case <-guard.abandoned:
+			fmt.Fprintln(guard.out, getCurrentDatetime()+" abandoned iteration finished")
+			guard.abandoned = nil
+		default:
+			return fmt.Errorf("%w: previous abandoned iteration is still running", IterationHungError)
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				fmt.Fprintf(guard.out, "%s Iteration panic: %v\n%s", getCurrentDatetime(), recovered, debug.Stack())
+				result <- fmt.Errorf("%w: %v", IterationPanicError, recovered)
+			}
+		}()
+
+		result <- iterationExecutor()
+	}()
+
+	if guard.timeout <= 0 {
+		return <-result
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(guard.timeout):
+		guard.abandoned = result
+		return fmt.Errorf("%w: no result after %s, iteration abandoned", IterationHungError, guard.timeout)
+	}
+}
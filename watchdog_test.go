@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGuardIteration(t *testing.T) {
+	t.Run("Pass result", func(t *testing.T) {
+		var out bytes.Buffer
+		expectedErr := errors.New("dummy error")
+		iteration := guardIteration(&out, time.Second, func() error {
+			return expectedErr
+		})
+
+		assert.Equal(t, expectedErr, iteration())
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("Recover panic", func(t *testing.T) {
+		var out bytes.Buffer
+		iteration := guardIteration(&out, 0, func() error {
+			var short string
+			_ = short[:10]
+			return nil
+		})
+
+		err := iteration()
+
+		assert.ErrorIs(t, err, IterationPanicError)
+		assert.Contains(t, err.Error(), "slice bounds out of range")
+		assert.Contains(t, out.String(), "Iteration panic: runtime error: slice bounds out of range")
+		assert.Contains(t, out.String(), "watchdog_test.go", "stack trace is not printed")
+	})
+
+	t.Run("Abandon hung iteration", func(t *testing.T) {
+		var out bytes.Buffer
+		release := make(chan struct{})
+		executedCount := 0
+		iteration := guardIteration(&out, time.Millisecond*10, func() error {
+			executedCount++
+			if executedCount == 1 {
+				<-release
+			}
+			return nil
+		})
+
+		err := iteration()
+		assert.ErrorIs(t, err, IterationHungError)
+		assert.Contains(t, err.Error(), "no result after 10ms, iteration abandoned")
+
+		err = iteration()
+		assert.ErrorIs(t, err, IterationHungError)
+		assert.Contains(t, err.Error(), "previous abandoned iteration is still running")
+
+		close(release)
+		time.Sleep(time.Millisecond * 10)
+
+		assert.NoError(t, iteration())
+		assert.Equal(t, 2, executedCount)
+		assert.Contains(t, out.String(), "abandoned iteration finished")
+	})
+}